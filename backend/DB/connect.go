@@ -1,56 +1,112 @@
 package db
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 
-	"pollingPlatform/models"
+	"pollingPlatform/config"
+	"pollingPlatform/logging"
+	"pollingPlatform/migrations"
+	"pollingPlatform/tracing"
 
-	"github.com/joho/godotenv"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
-func InitDB() {
+// Driver is the database in use, migrations.Postgres or migrations.SQLite
+var Driver string
+
+// InitDB connects and, unless automatic migrations are disabled, applies pending migrations
+func InitDB(cfg config.Database) {
+	Connect(cfg)
+	if !cfg.AutoMigrate {
+		slog.Info("Database connected; automatic migrations are disabled")
+		return
+	}
+
+	migrator, err := NewMigrator()
+	if err != nil {
+		logging.Fatal("Failed to load migrations", "error", err)
+	}
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		logging.Fatal("Failed to migrate database", "error", err)
+	}
+	for _, m := range applied {
+		slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+	}
+
+	slog.Info("Database connected and migrated successfully")
+}
+
+// Connect opens the configured database (postgres or sqlite) without touching the schema
+func Connect(cfg config.Database) {
 	var err error
 
-	// Load environment variables from .env file
-	err = godotenv.Load(".env")
+	Driver = cfg.Driver
+
+	var dialector gorm.Dialector
+	switch Driver {
+	case migrations.Postgres:
+		dialector = postgres.Open(postgresDSN(cfg))
+	case migrations.SQLite:
+		dialector = sqlite.Open(sqliteDSN(cfg))
+	default:
+		logging.Fatal("Invalid database driver, expected postgres or sqlite", "driver", Driver)
+	}
+
+	// TranslateError maps unique violations to gorm.ErrDuplicatedKey on both databases
+	DB, err = gorm.Open(dialector, &gorm.Config{TranslateError: true, Logger: newGormLogger()})
 	if err != nil {
-		log.Printf("Warning: Error loading .env file: %v", err)
-		log.Println("Attempting to load from parent directory...")
-		err = godotenv.Load("../.env")
+		logging.Fatal("Failed to connect to database", "error", err)
+	}
+	// Queries run under a traced request or job become child spans
+	if err := DB.Use(tracing.GormPlugin{}); err != nil {
+		logging.Fatal("Failed to register query tracing", "error", err)
+	}
+
+	if Driver == migrations.SQLite {
+		// SQLite allows one writer at a time; sharing a single connection queues
+		// writes in the pool instead of failing them with SQLITE_BUSY
+		sqlDB, err := DB.DB()
 		if err != nil {
-			log.Fatal("Error loading .env file from both current and parent directory")
+			logging.Fatal("Failed to configure database", "error", err)
 		}
+		sqlDB.SetMaxOpenConns(1)
 	}
+}
 
-	dbHost := os.Getenv("DB_HOST")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dbPort := os.Getenv("DB_PORT")
+func postgresDSN(cfg config.Database) string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
+		cfg.Host, cfg.User, cfg.Password, cfg.Name, cfg.Port)
+}
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		dbHost, dbUser, dbPassword, dbName, dbPort)
+// sqliteDSN opens the database file (":memory:" for a throwaway database) with
+// foreign keys enforced
+func sqliteDSN(cfg config.Database) string {
+	return "file:" + cfg.Path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
 
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// NewMigrator returns the schema migrator for the connected database
+func NewMigrator() (*migrations.Migrator, error) {
+	sqlDB, err := DB.DB()
 	if err != nil {
-		log.Fatal("Failed to connect to database: ", err)
-		os.Exit(1)
+		return nil, err
 	}
+	return migrations.New(sqlDB, Driver)
+}
 
-	// Auto Migrate the models
-	err = DB.AutoMigrate(&models.User{}, &models.Poll{}, &models.Option{}, &models.Vote{})
+// Close closes the connection pool
+func Close() error {
+	sqlDB, err := DB.DB()
 	if err != nil {
-		log.Fatal("Failed to migrate database: ", err)
-		os.Exit(1)
+		return err
 	}
-
-	log.Println("Database connected and migrated successfully!")
+	return sqlDB.Close()
 }
 
 // GetDB returns the database instance
@@ -0,0 +1,183 @@
+// Package cache provides a bounded in-memory LRU cache with per-entry TTLs.
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errLoadPanicked = errors.New("cache: load panicked")
+
+// Stats are the cache's counters since it was created
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// call is an in-flight load shared by concurrent misses on the same key
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+	// stale is set when the key is invalidated during the load. The call then leaves
+	// inflight so later callers start a fresh load, and its result, possibly read
+	// before the change, goes to the callers already waiting but is not stored.
+	stale bool
+}
+
+// LRU evicts the least recently used entry once it holds capacity entries.
+// It is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	capacity int
+
+	mu       sync.Mutex
+	ll       *list.List
+	items    map[K]*list.Element
+	inflight map[K]*call[V]
+	stats    Stats
+}
+
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element),
+		inflight: make(map[K]*call[V]),
+	}
+}
+
+// Get returns the cached value for key if present and not expired
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(key)
+}
+
+func (c *LRU[K, V]) get(key K) (V, bool) {
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		if time.Now().Before(e.expiresAt) {
+			c.ll.MoveToFront(el)
+			c.stats.Hits++
+			return e.value, true
+		}
+		c.removeElement(el)
+	}
+	c.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Set stores value for ttl
+func (c *LRU[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value, ttl)
+}
+
+func (c *LRU[K, V]) set(key K, value V, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	expiresAt := time.Now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value = value
+		e.expiresAt = expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	for c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// GetOrLoad returns the cached value or calls load to fill it. Concurrent misses on
+// the same key share one load. load returns how long the value may be cached.
+func (c *LRU[K, V]) GetOrLoad(key K, load func() (V, time.Duration, error)) (V, error) {
+	c.mu.Lock()
+	if value, ok := c.get(key); ok {
+		c.mu.Unlock()
+		return value, nil
+	}
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-cl.done
+		return cl.value, cl.err
+	}
+	cl := &call[V]{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	var ttl time.Duration
+	defer func() {
+		c.mu.Lock()
+		// A newer load may have taken the key since this one went stale
+		if c.inflight[key] == cl {
+			delete(c.inflight, key)
+		}
+		if cl.err == nil && !cl.stale {
+			c.set(key, cl.value, ttl)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+
+	// Waiters see an error rather than a zero value if load panics
+	cl.err = errLoadPanicked
+	cl.value, ttl, cl.err = load()
+	return cl.value, cl.err
+}
+
+// Delete removes key from the cache
+func (c *LRU[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl, ok := c.inflight[key]; ok {
+		cl.stale = true
+		delete(c.inflight, key)
+	}
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Purge removes every entry
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cl := range c.inflight {
+		cl.stale = true
+	}
+	c.inflight = make(map[K]*call[V])
+	c.ll.Init()
+	c.items = make(map[K]*list.Element)
+}
+
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.ll.Len()
+	stats.Capacity = c.capacity
+	return stats
+}
+
+func (c *LRU[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
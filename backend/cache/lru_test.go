@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInvalidationDuringLoad(t *testing.T) {
+	c := NewLRU[string, int](10)
+	loads := 0
+	load := func(value int, during func()) func() (int, time.Duration, error) {
+		return func() (int, time.Duration, error) {
+			loads++
+			if during != nil {
+				during()
+			}
+			return value, time.Minute, nil
+		}
+	}
+
+	// Invalidating another key doesn't keep this load out of the cache
+	c.GetOrLoad("a", load(1, func() { c.Delete("b") }))
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("a = %d, %v after an unrelated delete", v, ok)
+	}
+
+	// A load overtaken by a change to its own key is returned but not stored
+	if v, _ := c.GetOrLoad("b", load(2, func() { c.Delete("b") })); v != 2 {
+		t.Fatalf("load returned %d", v)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("value loaded before the delete was cached")
+	}
+	c.GetOrLoad("c", load(3, c.Purge))
+	if _, ok := c.Get("c"); ok {
+		t.Fatal("value loaded before the purge was cached")
+	}
+
+	c.GetOrLoad("b", load(4, nil))
+	if v, ok := c.Get("b"); !ok || v != 4 || loads != 4 {
+		t.Fatalf("b = %d, %v after %d loads", v, ok, loads)
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+	c.Get("a")
+	c.Set("c", 3, time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b survived although a was used more recently")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Fatalf("%s was evicted", key)
+		}
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c := NewLRU[string, int](10)
+	c.Set("short", 1, time.Millisecond)
+	c.Set("long", 2, time.Minute)
+	c.Set("none", 3, 0)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("short"); ok {
+		t.Fatal("expired entry returned")
+	}
+	if _, ok := c.Get("none"); ok {
+		t.Fatal("entry without a TTL was stored")
+	}
+	if v, ok := c.Get("long"); !ok || v != 2 {
+		t.Fatalf("long = %d, %v", v, ok)
+	}
+	if size := c.Stats().Size; size != 1 {
+		t.Fatalf("size %d, want the expired entry dropped", size)
+	}
+}
+
+func TestConcurrentMissesShareLoad(t *testing.T) {
+	c := NewLRU[string, int](10)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func() (int, time.Duration, error) {
+		loads.Add(1)
+		<-release
+		return 7, time.Minute, nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make(chan int, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _ := c.GetOrLoad("k", load)
+			results <- v
+		}()
+	}
+	waitFor(t, func() bool { return loads.Load() == 1 && c.Stats().Misses == callers })
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for v := range results {
+		if v != 7 {
+			t.Fatalf("caller got %d", v)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("%d loads for one key", n)
+	}
+}
+
+func TestLoadAfterDeleteIsFresh(t *testing.T) {
+	c := NewLRU[string, int](10)
+	started, release := make(chan struct{}), make(chan struct{})
+	old := make(chan int)
+	go func() {
+		v, _ := c.GetOrLoad("k", func() (int, time.Duration, error) {
+			close(started)
+			<-release
+			return 1, time.Minute, nil
+		})
+		old <- v
+	}()
+	<-started
+
+	// A write lands while the first load is still reading; the read that follows
+	// the write must not join that load
+	c.Delete("k")
+	fresh := make(chan int, 1)
+	go func() {
+		v, _ := c.GetOrLoad("k", func() (int, time.Duration, error) { return 2, time.Minute, nil })
+		fresh <- v
+	}()
+	select {
+	case v := <-fresh:
+		if v != 2 {
+			t.Fatalf("read after the delete got %d", v)
+		}
+	case <-time.After(time.Second):
+		close(release)
+		t.Fatal("read after the delete waited for the load it overtook")
+	}
+
+	close(release)
+	if v := <-old; v != 1 {
+		t.Fatalf("first load returned %d", v)
+	}
+	// The stale load finishing last neither caches its value nor drops the fresh one
+	if v, ok := c.Get("k"); !ok || v != 2 {
+		t.Fatalf("k = %d, %v after the stale load finished", v, ok)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	db "pollingPlatform/DB"
+	"pollingPlatform/config"
+	"pollingPlatform/reconcile"
+	"pollingPlatform/repository"
+	"strconv"
+	"time"
+)
+
+// runCommand runs a maintenance subcommand instead of the server and returns the exit
+// code. "config" prints the effective configuration with secrets redacted.
+func runCommand(cfg *config.Config, name string, args []string) int {
+	switch name {
+	case "reconcile":
+		return runReconcile(cfg, args)
+	case "migrate":
+		return runMigrate(cfg, args)
+	case "config":
+		fmt.Print(cfg)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\nusage: %s [flags] [reconcile [-repair] [-poll id] | migrate up|down [n]|status | config]\n", name, os.Args[0])
+		return 2
+	}
+}
+
+// runMigrate applies, reverts or lists schema migrations
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: migrate up | down [n] | status")
+		return 2
+	}
+
+	db.Connect(cfg.Database)
+	migrator, err := db.NewMigrator()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loading migrations failed:", err)
+		return 1
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migration failed:", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "down takes a positive number of migrations to revert")
+				return 2
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "revert failed:", err)
+			return 1
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "reading migration status failed:", err)
+			return 1
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q, expected up, down or status\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// runReconcile checks vote counters against ballots. It exits 1 when drift remains.
+func runReconcile(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "reset drifted counters to the number of ballots")
+	pollID := fs.Uint("poll", 0, "only check this poll")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	db.InitDB(cfg.Database)
+	reconciler := reconcile.NewReconciler(repository.NewPollRepository(db.GetDB()))
+	report, err := reconciler.Run(context.Background(), *pollID, *repair)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reconciliation failed:", err)
+		return 1
+	}
+
+	for _, d := range report.Drift {
+		fmt.Printf("poll %d option %d: counter %d, ballots %d\n", d.PollID, d.OptionID, d.Counter, d.Ballots)
+	}
+	if report.MismatchedVotes > 0 {
+		fmt.Printf("%d votes reference an option outside their poll\n", report.MismatchedVotes)
+	}
+	fmt.Printf("%d drifted options, %d repaired\n", len(report.Drift), report.RepairedOptions)
+
+	if report.MismatchedVotes > 0 || len(report.Drift) > report.RepairedOptions {
+		return 1
+	}
+	return 0
+}
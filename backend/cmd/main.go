@@ -1,87 +1,142 @@
 package main
 
 import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
 	db "pollingPlatform/DB"
-	"pollingPlatform/handlers"
-	"pollingPlatform/middleware"
-	"pollingPlatform/repository"
+	"pollingPlatform/config"
+	"pollingPlatform/logging"
+	"pollingPlatform/metrics"
+	"pollingPlatform/server"
+	"pollingPlatform/tracing"
+	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/gin-gonic/gin/binding"
-	"github.com/go-playground/validator/v10"
 )
 
 func main() {
-	// Initialize database
-	db.InitDB()
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		logging.Fatal("Invalid configuration", "error", err)
+	}
 
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(db.GetDB())
-	pollRepo := repository.NewPollRepository(db.GetDB())
+	// Structured logs on stdout; the standard log package is routed through them too
+	logger, _ := logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+	slog.SetDefault(logger)
+	if cfg.Log.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
 
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(userRepo)
-	pollHandler := handlers.NewPollHandler(pollRepo)
+	// Maintenance subcommands, e.g. "reconcile -repair"
+	if len(args) > 0 {
+		os.Exit(runCommand(cfg, args[0], args[1:]))
+	}
 
-	// Initialize Gin
-	r := gin.Default()
+	slog.Info("Starting with configuration", "config", cfg)
+	if err := serve(cfg); err != nil {
+		logging.Fatal("Server failed", "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
 
-	// Debug logging middleware
-	r.Use(func(c *gin.Context) {
-		println("Incoming request:", c.Request.Method, c.Request.URL.Path, "Origin:", c.Request.Header.Get("Origin"))
-		c.Next()
-	})
+// serve runs the API until SIGINT or SIGTERM. It then fails readiness for the drain
+// delay, stops accepting connections, waits for in-flight requests, stops the
+// background workers (delivering queued webhooks), closes the database and flushes
+// traces, all within cfg.Server.ShutdownTimeout.
+func serve(cfg *config.Config) error {
+	// Set when the shutdown signal arrives; every shutdown step finishes by then
+	var deadline time.Time
 
-	// Configure CORS
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "http://127.0.0.1:5173"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-
-	// Add custom validator for future dates
-	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
-		v.RegisterValidation("future", func(fl validator.FieldLevel) bool {
-			date, ok := fl.Field().Interface().(time.Time)
-			if !ok {
-				return false
-			}
-			return date.After(time.Now())
-		})
+	// Tracing; buffered spans are flushed last so the shutdown itself is exported
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		ctx := context.Background()
+		if !deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("Flushing traces failed", "error", err)
+		}
+	}()
 
-	// Routes
-	api := r.Group("/api")
-	{
-		// Auth routes
-		api.POST("/register", authHandler.Register)
-		api.POST("/login", authHandler.Login)
-		api.POST("/refresh-token", authHandler.RefreshToken)
-
-		// Public poll routes (no authentication required)
-		api.GET("/polls", pollHandler.ListPolls)
-		api.GET("/polls/:id", pollHandler.GetPoll)
-
-		// Protected routes
-		authenticated := api.Group("/")
-		authenticated.Use(middleware.AuthMiddleware())
-		{
-			authenticated.GET("/me", authHandler.GetMe)
-
-			// Rate limiters
-			pollCreationLimiter := middleware.NewRateLimiter(10, time.Hour) // 10 polls per hour
-			voteLimiter := middleware.NewRateLimiter(100, time.Minute)      // 100 votes per minute
-
-			// Protected poll routes (authentication required)
-			authenticated.POST("/polls", pollCreationLimiter.Middleware(), pollHandler.CreatePoll)
-			authenticated.POST("/polls/:id/vote", voteLimiter.Middleware(), pollHandler.Vote)
+	// Initialize database; closed last, after every worker has stopped
+	db.InitDB(cfg.Database)
+	defer func() {
+		if err := db.Close(); err != nil {
+			slog.Warn("Closing database failed", "error", err)
 		}
+	}()
+
+	// Stores, services and readiness checks; pool and cache statistics go on /metrics
+	var stats *metrics.Registry
+	if cfg.Metrics.Enabled {
+		stats = metrics.Default
 	}
+	services, err := server.NewServices(cfg, db.GetDB(), server.Options{Stats: stats})
+	if err != nil {
+		return err
+	}
+	services.Start()
+	defer services.Stop()
+
+	// Build the API
+	router := server.NewRouter(services.Deps)
+	srv := server.NewHTTPServer(cfg.Server, router)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "addr", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal kills the process immediately
+	stop()
+
+	// One deadline from the signal covers the drain delay, the request drain, the
+	// deferred worker shutdown and the trace flush. The hard exit is only a backstop
+	// for a step that ignores it, so it is never stopped.
+	deadline = time.Now().Add(cfg.Server.ShutdownTimeout)
+	time.AfterFunc(cfg.Server.ShutdownTimeout, func() {
+		logging.Fatal("Shutdown timed out")
+	})
+
+	// Keep serving while load balancers see /readyz fail and stop routing here
+	services.Health.Drain()
+	slog.Info("Shutting down, readiness withdrawn", "drain_delay", cfg.Server.DrainDelay)
+	time.Sleep(cfg.Server.DrainDelay)
+
+	slog.Info("Draining in-flight requests")
+
+	// Requests get what is left, minus the time kept for the workers and the flush
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline.Add(-shutdownReserve(cfg.Server.ShutdownTimeout)))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Some requests did not finish", "error", err)
+	}
+
+	// The deferred Stop and Close calls run now, newest worker first
+	slog.Info("Stopping background workers")
+	return nil
+}
 
-	r.Run(":8080")
+// shutdownReserve is the part of the shutdown timeout kept for stopping the
+// background workers and flushing traces after in-flight requests are drained
+func shutdownReserve(timeout time.Duration) time.Duration {
+	return min(timeout/4, 5*time.Second)
 }
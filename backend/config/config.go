@@ -0,0 +1,439 @@
+// Package config loads the server settings. Every setting has a default and can be
+// overridden by a YAML file, then an environment variable, then a command-line flag.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"pollingPlatform/logging"
+	"pollingPlatform/oidc"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Each setting is described by its struct tags: yaml is the key in the config file,
+// env the environment variable, flag the command-line flag and secret marks values
+// that are redacted when the configuration is printed.
+
+type Config struct {
+	Server      Server      `yaml:"server"`
+	Log         Log         `yaml:"log"`
+	Metrics     Metrics     `yaml:"metrics"`
+	Tracing     Tracing     `yaml:"tracing"`
+	Database    Database    `yaml:"database"`
+	JWT         JWT         `yaml:"jwt"`
+	RateLimit   RateLimit   `yaml:"rate_limit"`
+	PollCache   PollCache   `yaml:"poll_cache"`
+	Reconcile   Reconcile   `yaml:"reconcile"`
+	LoginAlerts LoginAlerts `yaml:"login_alerts"`
+	OIDC        OIDC        `yaml:"oidc"`
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr" env:"HTTP_ADDR" flag:"addr" help:"address to listen on"`
+	CORSOrigins       []string      `yaml:"cors_origins" env:"CORS_ORIGINS" flag:"cors-origins" help:"origins allowed to call the API from a browser"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" flag:"read-timeout" help:"time to read a whole request, 0 for none"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"read-header-timeout" help:"time to read request headers, 0 for none"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" flag:"write-timeout" help:"time to write a response, 0 for none"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" flag:"idle-timeout" help:"how long keep-alive connections stay open, 0 for none"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES" flag:"max-header-bytes" help:"largest accepted request header"`
+	MaxBodyBytes      int           `yaml:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES" flag:"max-body-bytes" help:"largest accepted request body"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" help:"time to drain requests and stop workers on SIGTERM"`
+	DrainDelay        time.Duration `yaml:"drain_delay" env:"SHUTDOWN_DRAIN_DELAY" flag:"drain-delay" help:"time /readyz reports shutting down before the listener closes"`
+}
+
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" flag:"log-level" help:"debug, info, warn or error"`
+	Format string `yaml:"format" env:"LOG_FORMAT" flag:"log-format" help:"json or text"`
+}
+
+type Metrics struct {
+	Enabled bool `yaml:"enabled" env:"METRICS_ENABLED" flag:"metrics" help:"serve Prometheus metrics at /metrics"`
+}
+
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" help:"none, stdout, file or otlp"`
+	File        string  `yaml:"file" env:"TRACING_FILE" flag:"tracing-file" help:"file the file exporter appends spans to"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_OTLP_ENDPOINT" flag:"tracing-otlp-endpoint" help:"OTLP/HTTP collector URL, defaults to OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName string  `yaml:"service_name" env:"OTEL_SERVICE_NAME" flag:"tracing-service-name" help:"service.name of exported spans"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" help:"fraction of new traces recorded; callers' sampling decisions are kept"`
+}
+
+type Database struct {
+	Driver      string `yaml:"driver" env:"DB_DRIVER" flag:"db-driver" help:"postgres or sqlite"`
+	Host        string `yaml:"host" env:"DB_HOST" flag:"db-host" help:"Postgres host"`
+	Port        int    `yaml:"port" env:"DB_PORT" flag:"db-port" help:"Postgres port"`
+	User        string `yaml:"user" env:"DB_USER" flag:"db-user" help:"Postgres user"`
+	Password    string `yaml:"password" env:"DB_PASSWORD" flag:"db-password" help:"Postgres password" secret:"true"`
+	Name        string `yaml:"name" env:"DB_NAME" flag:"db-name" help:"Postgres database"`
+	Path        string `yaml:"path" env:"DB_PATH" flag:"db-path" help:"SQLite file, or :memory:"`
+	AutoMigrate bool   `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE" flag:"db-auto-migrate" help:"apply pending migrations at startup"`
+}
+
+type JWT struct {
+	Secret            string        `yaml:"secret" env:"JWT_SECRET" flag:"jwt-secret" help:"encrypts signing keys at rest" secret:"true"`
+	SigningAlg        string        `yaml:"signing_alg" env:"JWT_SIGNING_ALG" flag:"jwt-signing-alg" help:"RS256 or EdDSA"`
+	Issuer            string        `yaml:"issuer" env:"JWT_ISSUER" flag:"jwt-issuer" help:"iss claim of issued tokens"`
+	KeyRotation       time.Duration `yaml:"key_rotation" env:"JWT_KEY_ROTATION" flag:"jwt-key-rotation" help:"how long a signing key is used"`
+	AcceptLegacyHS256 bool          `yaml:"accept_legacy_hs256" env:"JWT_ACCEPT_LEGACY_HS256" flag:"jwt-accept-legacy-hs256" help:"accept tokens signed with the secret before key rotation"`
+}
+
+type RateLimit struct {
+	Store    string `yaml:"store" env:"RATE_LIMIT_STORE" flag:"rate-limit-store" help:"memory or postgres"`
+	Policies string `yaml:"policies" env:"RATE_LIMIT_POLICIES" flag:"rate-limit-policies" help:"overrides such as vote=200/1m,poll-create=5/1h"`
+}
+
+type PollCache struct {
+	Size int `yaml:"size" env:"POLL_CACHE_SIZE" flag:"poll-cache-size" help:"polls cached in memory, 0 disables"`
+}
+
+type Reconcile struct {
+	Interval time.Duration `yaml:"interval" env:"RECONCILE_INTERVAL" flag:"reconcile-interval" help:"how often vote counters are checked, 0 disables"`
+	Repair   bool          `yaml:"repair" env:"RECONCILE_REPAIR" flag:"reconcile-repair" help:"fix drifted counters automatically"`
+}
+
+type LoginAlerts struct {
+	WebhookURL string `yaml:"webhook_url" env:"LOGIN_ALERT_WEBHOOK_URL" flag:"login-alert-webhook-url" help:"receives brute-force alerts" secret:"true"`
+}
+
+type OIDC struct {
+	IssuerURL           string   `yaml:"issuer_url" env:"OIDC_ISSUER_URL" flag:"oidc-issuer-url" help:"enables single sign-on"`
+	ClientID            string   `yaml:"client_id" env:"OIDC_CLIENT_ID" flag:"oidc-client-id"`
+	ClientSecret        string   `yaml:"client_secret" env:"OIDC_CLIENT_SECRET" flag:"oidc-client-secret" secret:"true"`
+	RedirectURL         string   `yaml:"redirect_url" env:"OIDC_REDIRECT_URL" flag:"oidc-redirect-url"`
+	Scopes              []string `yaml:"scopes" env:"OIDC_SCOPES" flag:"oidc-scopes"`
+	GroupsClaim         string   `yaml:"groups_claim" env:"OIDC_GROUPS_CLAIM" flag:"oidc-groups-claim"`
+	RoleMapping         string   `yaml:"role_mapping" env:"OIDC_ROLE_MAPPING" flag:"oidc-role-mapping" help:"group=role pairs"`
+	FrontendRedirectURL string   `yaml:"frontend_redirect_url" env:"OIDC_FRONTEND_REDIRECT_URL" flag:"oidc-frontend-redirect-url"`
+}
+
+// Default returns the settings used when nothing overrides them
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			CORSOrigins:       []string{"http://localhost:5173", "http://127.0.0.1:5173"},
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    64 << 10,
+			MaxBodyBytes:      1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+			DrainDelay:        5 * time.Second,
+		},
+		Log:     Log{Level: "info", Format: "json"},
+		Metrics: Metrics{Enabled: true},
+		Tracing: Tracing{
+			Exporter:    "none",
+			File:        "traces.json",
+			ServiceName: "polling-platform",
+			SampleRatio: 1,
+		},
+		Database: Database{
+			Driver:      "postgres",
+			Host:        "localhost",
+			Port:        5432,
+			Path:        "polling.db",
+			AutoMigrate: true,
+		},
+		JWT: JWT{
+			SigningAlg:  "RS256",
+			KeyRotation: 24 * time.Hour,
+		},
+		RateLimit: RateLimit{Store: "memory"},
+		PollCache: PollCache{Size: 1000},
+		Reconcile: Reconcile{Interval: time.Hour},
+	}
+}
+
+// Load reads the configuration for the command line args (without the program
+// name) and validates it. The file comes from -config or CONFIG_FILE; a .env file in
+// the working directory or its parent is loaded into the environment first without
+// overriding variables that are already set. Load returns the arguments left after
+// the flags.
+func Load(args []string) (*Config, []string, error) {
+	if err := godotenv.Load(".env"); err != nil {
+		godotenv.Load("../.env")
+	}
+
+	cfg := Default()
+	settings := cfg.settings()
+
+	// Flags are parsed first to find the file but applied last
+	fs := flag.NewFlagSet("pollingPlatform", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	var flagged []func() error
+	for _, s := range settings {
+		s := s
+		record := func(value string) error {
+			flagged = append(flagged, func() error {
+				if err := s.set(value); err != nil {
+					return fmt.Errorf("-%s: %w", s.flag, err)
+				}
+				return nil
+			})
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			fs.BoolFunc(s.flag, s.help, record)
+		} else {
+			fs.Func(s.flag, s.help, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(value); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, apply := range flagged {
+		if err := apply(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, fs.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		fail("server.addr %q: %v", c.Server.Addr, err)
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.ReadHeaderTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		fail("server timeouts must not be negative")
+	}
+	if c.Server.MaxHeaderBytes < 1 || c.Server.MaxBodyBytes < 1 {
+		fail("server.max_header_bytes and server.max_body_bytes must be positive")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout must be positive")
+	}
+	if c.Server.DrainDelay < 0 || c.Server.DrainDelay >= c.Server.ShutdownTimeout {
+		fail("server.drain_delay must be between 0 and server.shutdown_timeout")
+	}
+
+	if _, err := logging.New(io.Discard, c.Log.Level, c.Log.Format); err != nil {
+		fail("log: %v", err)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		if c.Tracing.File == "" {
+			fail("tracing.file is required for the file exporter")
+		}
+	default:
+		fail("tracing.exporter %q, expected none, stdout, file or otlp", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio %v must be between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	switch c.Database.Driver {
+	case "postgres":
+		if c.Database.Host == "" || c.Database.Name == "" || c.Database.User == "" {
+			fail("database.host, database.name and database.user are required for postgres")
+		}
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			fail("database.port %d is out of range", c.Database.Port)
+		}
+	case "sqlite":
+		if c.Database.Path == "" {
+			fail("database.path is required for sqlite")
+		}
+	default:
+		fail("database.driver %q, expected postgres or sqlite", c.Database.Driver)
+	}
+
+	if c.JWT.Secret == "" {
+		fail("jwt.secret is required (JWT_SECRET)")
+	}
+	if c.JWT.SigningAlg != "RS256" && c.JWT.SigningAlg != "EdDSA" {
+		fail("jwt.signing_alg %q, expected RS256 or EdDSA", c.JWT.SigningAlg)
+	}
+	if c.JWT.KeyRotation <= 0 {
+		fail("jwt.key_rotation must be positive")
+	}
+
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "postgres" {
+		fail("rate_limit.store %q, expected memory or postgres", c.RateLimit.Store)
+	}
+	// The postgres store shares counters between instances through the database, which
+	// a local SQLite file can't do
+	if c.RateLimit.Store == "postgres" && c.Database.Driver != "postgres" {
+		fail("rate_limit.store postgres requires database.driver postgres")
+	}
+
+	if c.PollCache.Size < 0 {
+		fail("poll_cache.size must not be negative")
+	}
+	if c.Reconcile.Interval < 0 {
+		fail("reconcile.interval must not be negative")
+	}
+
+	if c.OIDC.IssuerURL != "" {
+		if c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			fail("oidc.client_id and oidc.redirect_url are required with oidc.issuer_url")
+		}
+		if _, err := oidc.ParseRoleMappings(c.OIDC.RoleMapping); err != nil {
+			fail("oidc.role_mapping: %v", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy with every secret that is set replaced by "REDACTED"
+func (c Config) Redacted() Config {
+	for _, s := range c.settings() {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString("REDACTED")
+		}
+	}
+	return c
+}
+
+// String renders the configuration as YAML with secrets redacted
+func (c Config) String() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// LogValue logs the configuration with secrets redacted and keys as in the file
+func (c Config) LogValue() slog.Value {
+	var fields map[string]any
+	out, err := yaml.Marshal(c.Redacted())
+	if err == nil {
+		err = yaml.Unmarshal(out, &fields)
+	}
+	if err != nil {
+		return slog.StringValue(err.Error())
+	}
+	return slog.AnyValue(fields)
+}
+
+// setting is one configurable field
+type setting struct {
+	env    string
+	flag   string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+// settings lists the leaf fields of c; their values can be set through the result
+func (c *Config) settings() []setting {
+	var out []setting
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(v.Field(i))
+				continue
+			}
+			out = append(out, setting{
+				env:    field.Tag.Get("env"),
+				flag:   field.Tag.Get("flag"),
+				help:   field.Tag.Get("help"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem())
+	return out
+}
+
+// set parses an environment variable or flag value into the setting. Lists are
+// separated by commas or spaces.
+func (s setting) set(value string) error {
+	value = strings.TrimSpace(value)
+	v := s.value
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
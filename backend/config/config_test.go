@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`
+server:
+  addr: ":9000"
+  cors_origins: [https://polls.example.com]
+database:
+  driver: sqlite
+reconcile:
+  interval: 5m
+  repair: true
+poll_cache:
+  size: 10
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_SECRET", "from-env")
+	t.Setenv("RECONCILE_INTERVAL", "10m")
+	t.Setenv("POLL_CACHE_SIZE", "20")
+	t.Setenv("OIDC_SCOPES", "openid profile,email")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+
+	cfg, args, err := Load([]string{"-config", file, "-poll-cache-size", "30", "-reconcile-repair=false", "migrate", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Addr != ":9000" || cfg.Database.Driver != "sqlite" {
+		t.Errorf("file values not applied: addr %q, driver %q", cfg.Server.Addr, cfg.Database.Driver)
+	}
+	if len(cfg.Server.CORSOrigins) != 1 || cfg.Server.CORSOrigins[0] != "https://polls.example.com" {
+		t.Errorf("cors origins %v", cfg.Server.CORSOrigins)
+	}
+	if cfg.Database.Path != "polling.db" {
+		t.Errorf("default sqlite path lost: %q", cfg.Database.Path)
+	}
+	if cfg.Reconcile.Interval != 10*time.Minute {
+		t.Errorf("env should override file: interval %v", cfg.Reconcile.Interval)
+	}
+	if cfg.PollCache.Size != 30 || cfg.Reconcile.Repair {
+		t.Errorf("flags should override env and file: size %d, repair %v", cfg.PollCache.Size, cfg.Reconcile.Repair)
+	}
+	if cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("sample ratio %v", cfg.Tracing.SampleRatio)
+	}
+	if strings.Join(cfg.OIDC.Scopes, "|") != "openid|profile|email" {
+		t.Errorf("scopes %v", cfg.OIDC.Scopes)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("remaining args %v", args)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("DB_DRIVER", "sqlite")
+
+	_, _, err := Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "jwt.secret is required") {
+		t.Fatalf("empty secret accepted: %v", err)
+	}
+
+	t.Setenv("JWT_SECRET", "secret")
+	if _, _, err := Load([]string{"-poll-cache-size", "lots"}); err == nil || !strings.Contains(err.Error(), "-poll-cache-size") {
+		t.Fatalf("bad flag value: %v", err)
+	}
+
+	if _, _, err := Load([]string{"-rate-limit-store", "postgres"}); err == nil || !strings.Contains(err.Error(), "rate_limit.store postgres") {
+		t.Fatalf("postgres rate limits on sqlite accepted: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("server:\n  adress: \":1\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load([]string{"-config", file}); err == nil {
+		t.Fatal("unknown key in config file accepted")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.JWT.Secret = "hunter2"
+	cfg.Database.Password = "pa55"
+
+	out := cfg.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "pa55") {
+		t.Fatalf("secret printed:\n%s", out)
+	}
+	if !strings.Contains(out, "secret: REDACTED") || !strings.Contains(out, `client_secret: ""`) {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	if cfg.JWT.Secret != "hunter2" {
+		t.Fatal("Redacted modified the original")
+	}
+}
@@ -0,0 +1,108 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRoleEscalation(t *testing.T) {
+	h := New(t)
+	admin := h.Register(t, "admin")
+	h.SetRole(t, admin, "admin")
+	// Both hold what regular users have, so they can manage them
+	for name, perm := range map[string]string{"user-manager": "users:manage", "role-manager": "roles:manage"} {
+		h.Do(t, Request{
+			Method: http.MethodPost,
+			Path:   "/api/admin/roles",
+			Token:  admin.AccessToken,
+			Body:   map[string]any{"name": name, "permissions": []string{"polls:create", "polls:vote", perm}},
+		}).Expect(t, http.StatusCreated)
+	}
+
+	assignRole := func(t *testing.T, caller, target *User, role string) *Response {
+		return h.Do(t, Request{
+			Method: http.MethodPut,
+			Path:   fmt.Sprintf("/api/admin/users/%d/role", target.ID),
+			Token:  caller.AccessToken,
+			Body:   map[string]string{"role": role},
+		})
+	}
+	setPermissions := func(t *testing.T, caller *User, role string, permissions ...string) *Response {
+		return h.Do(t, Request{
+			Method: http.MethodPut,
+			Path:   "/api/admin/roles/" + role + "/permissions",
+			Token:  caller.AccessToken,
+			Body:   map[string]any{"permissions": permissions},
+		})
+	}
+
+	t.Run("AssignRole", func(t *testing.T) {
+		mallory := h.Register(t, "mallory")
+		h.SetRole(t, mallory, "user-manager")
+		accomplice := h.Register(t, "accomplice")
+
+		assignRole(t, mallory, mallory, "admin").Expect(t, http.StatusForbidden)
+		assignRole(t, mallory, accomplice, "admin").Expect(t, http.StatusForbidden)
+		assignRole(t, mallory, accomplice, "moderator").Expect(t, http.StatusForbidden)
+		assignRole(t, mallory, admin, "user").Expect(t, http.StatusForbidden)
+
+		// Roles within the caller's own permissions can still be handed out
+		assignRole(t, mallory, accomplice, "user-manager").Expect(t, http.StatusOK)
+		assignRole(t, admin, accomplice, "moderator").Expect(t, http.StatusOK)
+	})
+
+	t.Run("IfMatch", func(t *testing.T) {
+		target := h.Register(t, "target")
+		var me struct {
+			User struct {
+				Version uint `json:"version"`
+			} `json:"user"`
+		}
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/me", Token: target.AccessToken}).Expect(t, http.StatusOK).JSON(t, &me)
+		read := fmt.Sprintf(`"v%d"`, me.User.Version)
+
+		change := func(path string, body map[string]string, ifMatch string) *Response {
+			return h.Do(t, Request{
+				Method:  http.MethodPut,
+				Path:    fmt.Sprintf("/api/admin/users/%d/%s", target.ID, path),
+				Token:   admin.AccessToken,
+				Headers: map[string]string{"If-Match": ifMatch},
+				Body:    body,
+			})
+		}
+		resp := change("role", map[string]string{"role": "moderator"}, read).Expect(t, http.StatusOK)
+
+		// Whoever still looks at the version before that change must not overwrite it
+		change("plan", map[string]string{"plan": "pro"}, read).Expect(t, http.StatusPreconditionFailed)
+		change("role", map[string]string{"role": "user"}, read).Expect(t, http.StatusPreconditionFailed)
+		change("role", map[string]string{"role": "user"}, "W/"+resp.Header.Get("ETag")).Expect(t, http.StatusPreconditionFailed)
+		change("role", map[string]string{"role": "user"}, "*").Expect(t, http.StatusPreconditionFailed)
+		change("plan", map[string]string{"plan": "pro"}, resp.Header.Get("ETag")).Expect(t, http.StatusOK)
+
+		stored, err := h.Deps.Users.GetUserByID(target.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Role != "moderator" || stored.Plan != "pro" {
+			t.Fatalf("user has role %q and plan %q", stored.Role, stored.Plan)
+		}
+	})
+
+	t.Run("RolePermissions", func(t *testing.T) {
+		rita := h.Register(t, "rita")
+		h.SetRole(t, rita, "role-manager")
+
+		setPermissions(t, rita, "role-manager", "polls:vote", "roles:manage", "users:manage").Expect(t, http.StatusForbidden)
+		setPermissions(t, rita, "moderator", "polls:vote").Expect(t, http.StatusForbidden)
+		h.Do(t, Request{
+			Method: http.MethodPost,
+			Path:   "/api/admin/roles",
+			Token:  rita.AccessToken,
+			Body:   map[string]any{"name": "backdoor", "permissions": []string{"security:manage"}},
+		}).Expect(t, http.StatusForbidden)
+
+		setPermissions(t, rita, "user", "polls:vote").Expect(t, http.StatusOK)
+		setPermissions(t, admin, "role-manager", "polls:vote", "roles:manage", "users:manage").Expect(t, http.StatusOK)
+	})
+}
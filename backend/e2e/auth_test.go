@@ -0,0 +1,137 @@
+package e2e
+
+import (
+	"net/http"
+	"pollingPlatform/middleware"
+	"sync"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	h := New(t)
+
+	t.Run("RegisterLoginMe", func(t *testing.T) {
+		user := h.Register(t, "alice")
+		if user.ID == 0 || user.AccessToken == "" || user.RefreshToken == "" {
+			t.Fatalf("registered user %+v", user)
+		}
+	})
+
+	t.Run("DuplicateEmail", func(t *testing.T) {
+		h.Register(t, "bob")
+		h.Do(t, Request{
+			Method: http.MethodPost,
+			Path:   "/api/register",
+			Body:   map[string]string{"username": "bobby", "email": "bob@example.com", "password": DefaultPassword},
+		}).Expect(t, http.StatusConflict)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		h.Register(t, "carol")
+		h.Do(t, Request{
+			Method: http.MethodPost,
+			Path:   "/api/login",
+			Body:   map[string]string{"email": "carol@example.com", "password": "not-the-password"},
+		}).Expect(t, http.StatusUnauthorized)
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/me"}).Expect(t, http.StatusUnauthorized)
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/me", Token: "garbage"}).Expect(t, http.StatusUnauthorized)
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		user := h.Register(t, "dave")
+		var tokens struct {
+			AccessToken string `json:"access_token"`
+		}
+		h.Do(t, Request{
+			Method: http.MethodPost,
+			Path:   "/api/refresh-token",
+			Body:   map[string]string{"refresh_token": user.RefreshToken},
+		}).Expect(t, http.StatusOK).JSON(t, &tokens)
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/me", Token: tokens.AccessToken}).Expect(t, http.StatusOK)
+	})
+
+	t.Run("TokenTypes", func(t *testing.T) {
+		user := h.Register(t, "frank")
+		// A refresh token is not a bearer credential
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/me", Token: user.RefreshToken}).Expect(t, http.StatusUnauthorized)
+		// and an access token can't be refreshed
+		h.Do(t, Request{
+			Method: http.MethodPost,
+			Path:   "/api/refresh-token",
+			Body:   map[string]string{"refresh_token": user.AccessToken},
+		}).Expect(t, http.StatusUnauthorized)
+	})
+
+	t.Run("AdminRoutesNeedRole", func(t *testing.T) {
+		user := h.Register(t, "erin")
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/admin/plans", Token: user.AccessToken}).Expect(t, http.StatusForbidden)
+
+		h.SetRole(t, user, "admin")
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/admin/plans", Token: user.AccessToken}).Expect(t, http.StatusOK)
+	})
+}
+
+func TestLoginGuard(t *testing.T) {
+	h := New(t)
+	user := h.Register(t, "alice")
+
+	// Successful logins don't count against the IP
+	for range 2 * middleware.DefaultLoginGuardConfig().FreeAttempts {
+		h.Login(t, user)
+	}
+
+	// Parallel guesses can't all get past the check before the first one fails
+	const guesses = 10
+	statuses := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- h.Do(t, Request{
+				Method: http.MethodPost,
+				Path:   "/api/login",
+				Body:   map[string]string{"email": user.Email, "password": "wrong"},
+			}).Status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	// The free attempts, plus the one that starts the delay
+	if allowed := middleware.DefaultLoginGuardConfig().FreeAttempts + 1; counts[http.StatusUnauthorized] != allowed || counts[http.StatusTooManyRequests] != guesses-allowed {
+		t.Fatalf("statuses %v", counts)
+	}
+}
+
+func TestLoginDuringOutageDoesNotLock(t *testing.T) {
+	h := New(t)
+	user := h.Register(t, "alice")
+
+	// Lookups fail inside the driver; that says nothing about the credentials
+	if err := h.DB.Exec("ALTER TABLE users RENAME TO users_moved").Error; err != nil {
+		t.Fatal(err)
+	}
+	for range middleware.DefaultLoginGuardConfig().AccountLockoutThreshold + 1 {
+		h.Do(t, Request{
+			Method: http.MethodPost,
+			Path:   "/api/login",
+			Body:   map[string]string{"email": user.Email, "password": user.Password},
+		}).Expect(t, http.StatusInternalServerError)
+	}
+	if err := h.DB.Exec("ALTER TABLE users_moved RENAME TO users").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	h.Login(t, user)
+	if lockouts := h.Deps.LoginGuard.Lockouts(); len(lockouts) != 0 {
+		t.Fatalf("outage left failures behind: %+v", lockouts)
+	}
+}
@@ -0,0 +1,65 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"pollingPlatform/repository/storetest"
+	"testing"
+	"time"
+)
+
+func TestEditPoll(t *testing.T) {
+	h := New(t)
+	owner := h.Register(t, "owner")
+	voter := h.Register(t, "voter")
+
+	edit := func(t *testing.T, pollID uint, headers map[string]string, body map[string]any) *Response {
+		t.Helper()
+		if body == nil {
+			body = map[string]any{}
+		}
+		body["title"] = "Edited title"
+		body["description"] = "Edited description"
+		if _, ok := body["endDate"]; !ok {
+			body["endDate"] = time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+		}
+		return h.Do(t, Request{
+			Method:  http.MethodPut,
+			Path:    fmt.Sprintf("/api/polls/%d", pollID),
+			Token:   owner.AccessToken,
+			Headers: headers,
+			Body:    body,
+		})
+	}
+
+	t.Run("IfMatchSurvivesVotes", func(t *testing.T) {
+		poll := h.CreatePoll(t, owner, "Lunch", "pizza", "salad")
+		etag := h.Do(t, Request{Method: http.MethodGet, Path: fmt.Sprintf("/api/polls/%d", poll.ID)}).Expect(t, http.StatusOK).Header.Get("ETag")
+
+		// A vote changes the representation but isn't an edit
+		h.Vote(t, voter, poll.ID, 0).Expect(t, http.StatusOK)
+		resp := edit(t, poll.ID, map[string]string{"If-Match": etag}, nil).Expect(t, http.StatusOK)
+
+		// Another edit is, so the old validator no longer applies
+		edit(t, poll.ID, map[string]string{"If-Match": etag}, nil).Expect(t, http.StatusPreconditionFailed)
+		edit(t, poll.ID, map[string]string{"If-Match": resp.Header.Get("ETag")}, nil).Expect(t, http.StatusOK)
+		// Only a strong tag naming a concrete version will do
+		edit(t, poll.ID, map[string]string{"If-Match": `W/"v3"`}, nil).Expect(t, http.StatusPreconditionFailed)
+		edit(t, poll.ID, map[string]string{"If-Match": "*"}, nil).Expect(t, http.StatusPreconditionFailed)
+		edit(t, poll.ID, map[string]string{"If-Match": `"v3"`}, nil).Expect(t, http.StatusOK)
+		edit(t, poll.ID, nil, map[string]any{"version": 3}).Expect(t, http.StatusConflict)
+		edit(t, poll.ID, nil, nil).Expect(t, http.StatusPreconditionRequired)
+	})
+
+	t.Run("EndedPoll", func(t *testing.T) {
+		ended := storetest.NewPoll(owner.ID, -time.Minute, "yes", "no")
+		if err := h.Deps.Polls.CreatePoll(ended); err != nil {
+			t.Fatal(err)
+		}
+		// Moving the end date would reopen voting on final results
+		edit(t, ended.ID, nil, map[string]any{"version": ended.Version}).Expect(t, http.StatusBadRequest)
+		if got := h.GetPoll(t, ended.ID); got.IsActive() || got.Title != "Poll" {
+			t.Fatalf("ended poll was edited: %+v", got)
+		}
+	})
+}
@@ -0,0 +1,295 @@
+// Package e2e runs the complete API router over HTTP against a private in-memory
+// SQLite database, optionally with the in-memory poll and user stores.
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pollingPlatform/config"
+	"pollingPlatform/migrations"
+	"pollingPlatform/models"
+	"pollingPlatform/oidc/oidctest"
+	"pollingPlatform/repository/memstore"
+	"pollingPlatform/repository/storetest"
+	"pollingPlatform/server"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Harness is a running API server plus helpers for driving it
+type Harness struct {
+	Server *httptest.Server
+	DB     *gorm.DB
+	Deps   server.Deps
+}
+
+type options struct {
+	memoryStores bool
+	cfg          config.Config
+}
+
+type Option func(*options)
+
+// WithMemoryStores uses the in-memory poll and user stores instead of GORM. Personal
+// access tokens reference users by foreign key, so token routes need the GORM stores.
+func WithMemoryStores() Option {
+	return func(o *options) { o.memoryStores = true }
+}
+
+// WithRateLimit sets one route policy, e.g. WithRateLimit("vote", 3, time.Minute).
+// Every other policy is effectively unlimited so tests don't trip over each other.
+func WithRateLimit(name string, limit int, period time.Duration) Option {
+	return func(o *options) {
+		o.cfg.RateLimit.Policies += fmt.Sprintf(",%s=%d/%s", name, limit, period)
+	}
+}
+
+// WithOIDC enables single sign-on against idp, mapping groups to roles as in
+// "group=role,other=role". The provider redirects back to OIDCRedirectURL.
+func WithOIDC(idp *oidctest.Server, roleMapping string) Option {
+	return func(o *options) {
+		o.cfg.OIDC = config.OIDC{
+			IssuerURL:    idp.Issuer(),
+			ClientID:     idp.ClientID,
+			ClientSecret: idp.ClientSecret,
+			RedirectURL:  OIDCRedirectURL,
+			RoleMapping:  roleMapping,
+		}
+	}
+}
+
+// OIDCRedirectURL is the callback registered with the identity provider. Nothing
+// listens there; tests replay its query string against the server.
+const OIDCRedirectURL = "http://app.test/api/auth/oidc/callback"
+
+// MaxBodyBytes is the request body limit of the test server
+const MaxBodyBytes = 64 << 10
+
+// New starts a server that is shut down when the test ends
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	// The production configuration on SQLite, with every rate limit effectively off
+	// so tests don't trip over each other
+	o := options{cfg: config.Default()}
+	o.cfg.Database.Driver = migrations.SQLite
+	o.cfg.JWT.SigningAlg = "EdDSA"
+	o.cfg.JWT.Secret = "e2e-test-secret-e2e-test-secret"
+	o.cfg.Server.CORSOrigins = nil
+	o.cfg.Server.MaxBodyBytes = MaxBodyBytes
+	var unlimited []string
+	for name, policy := range server.DefaultRateLimits() {
+		unlimited = append(unlimited, fmt.Sprintf("%s=1000000/%s", name, policy.Period))
+	}
+	o.cfg.RateLimit.Policies = strings.Join(unlimited, ",")
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	db := storetest.OpenSQLite(t)
+
+	// Background workers aren't started; tests drive the API only
+	var stores server.Options
+	if o.memoryStores {
+		stores.Polls = memstore.NewPollStore()
+		stores.Users = memstore.NewUserStore()
+	}
+	services, err := server.NewServices(&o.cfg, db, stores)
+	if err != nil {
+		t.Fatalf("building services: %v", err)
+	}
+	deps := services.Deps
+
+	srv := httptest.NewServer(server.NewRouter(deps))
+	t.Cleanup(srv.Close)
+
+	return &Harness{Server: srv, DB: db, Deps: deps}
+}
+
+// Response is a fully read HTTP response
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// JSON decodes the body into v, failing the test if it isn't valid JSON
+func (r *Response) JSON(t testing.TB, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("decoding %s: %v", r.Body, err)
+	}
+}
+
+// Request is one API call; zero fields are left out
+type Request struct {
+	Method  string
+	Path    string
+	Token   string
+	Body    any
+	Headers map[string]string
+}
+
+// Do sends req and reads the whole response
+func (h *Harness) Do(t testing.TB, req Request) *Response {
+	t.Helper()
+
+	var body io.Reader
+	if req.Body != nil {
+		encoded, err := json.Marshal(req.Body)
+		if err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	httpReq, err := http.NewRequest(req.Method, h.Server.URL+req.Path, body)
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	if req.Body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+req.Token)
+	}
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := h.Server.Client().Do(httpReq)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.Path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	return &Response{Status: resp.StatusCode, Header: resp.Header, Body: data}
+}
+
+// Expect fails the test unless the response has the wanted status
+func (r *Response) Expect(t testing.TB, status int) *Response {
+	t.Helper()
+	if r.Status != status {
+		t.Fatalf("status %d, want %d: %s", r.Status, status, r.Body)
+	}
+	return r
+}
+
+// User is a registered account with a valid access token
+type User struct {
+	ID           uint
+	Username     string
+	Email        string
+	Password     string
+	AccessToken  string
+	RefreshToken string
+}
+
+// DefaultPassword satisfies the password rules
+const DefaultPassword = "Passw0rd!"
+
+// Register creates an account and logs it in
+func (h *Harness) Register(t testing.TB, username string) *User {
+	t.Helper()
+	user := &User{Username: username, Email: username + "@example.com", Password: DefaultPassword}
+	h.Do(t, Request{
+		Method: http.MethodPost,
+		Path:   "/api/register",
+		Body:   map[string]string{"username": user.Username, "email": user.Email, "password": user.Password},
+	}).Expect(t, http.StatusCreated)
+
+	h.Login(t, user)
+
+	var me struct {
+		User models.User `json:"user"`
+	}
+	h.Do(t, Request{Method: http.MethodGet, Path: "/api/me", Token: user.AccessToken}).Expect(t, http.StatusOK).JSON(t, &me)
+	user.ID = me.User.ID
+	return user
+}
+
+// Login refreshes the user's tokens
+func (h *Harness) Login(t testing.TB, user *User) {
+	t.Helper()
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	h.Do(t, Request{
+		Method: http.MethodPost,
+		Path:   "/api/login",
+		Body:   map[string]string{"email": user.Email, "password": user.Password},
+	}).Expect(t, http.StatusOK).JSON(t, &tokens)
+	user.AccessToken = tokens.AccessToken
+	user.RefreshToken = tokens.RefreshToken
+}
+
+// SetRole changes the user's role directly in the store and logs in again so the
+// new role is in the token
+func (h *Harness) SetRole(t testing.TB, user *User, role string) {
+	t.Helper()
+	stored, err := h.Deps.Users.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("setting role: %v", err)
+	}
+	if err := h.Deps.Users.UpdateRole(user.ID, role, stored.Version); err != nil {
+		t.Fatalf("setting role: %v", err)
+	}
+	h.Login(t, user)
+}
+
+// CreatePoll creates a poll owned by user that ends in a day
+func (h *Harness) CreatePoll(t testing.TB, user *User, title string, options ...string) *models.Poll {
+	t.Helper()
+	opts := make([]map[string]string, len(options))
+	for i, text := range options {
+		opts[i] = map[string]string{"text": text}
+	}
+
+	var created struct {
+		Data models.Poll `json:"data"`
+	}
+	h.Do(t, Request{
+		Method: http.MethodPost,
+		Path:   "/api/polls",
+		Token:  user.AccessToken,
+		Body: map[string]any{
+			"title":       title,
+			"description": "Created by the e2e harness",
+			"endDate":     time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+			"options":     opts,
+		},
+	}).Expect(t, http.StatusCreated).JSON(t, &created)
+	return &created.Data
+}
+
+// Vote votes for the option at index and returns the response unchecked
+func (h *Harness) Vote(t testing.TB, user *User, pollID uint, index int) *Response {
+	t.Helper()
+	return h.Do(t, Request{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/api/polls/%d/vote", pollID),
+		Token:  user.AccessToken,
+		Body:   map[string]int{"option_index": index},
+	})
+}
+
+// GetPoll fetches a poll through the public endpoint
+func (h *Harness) GetPoll(t testing.TB, pollID uint) *models.Poll {
+	t.Helper()
+	var poll models.Poll
+	h.Do(t, Request{Method: http.MethodGet, Path: fmt.Sprintf("/api/polls/%d", pollID)}).Expect(t, http.StatusOK).JSON(t, &poll)
+	return &poll
+}
@@ -0,0 +1,63 @@
+package e2e
+
+import (
+	"net/http"
+	"pollingPlatform/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestIdempotency(t *testing.T) {
+	h := New(t)
+	user := h.Register(t, "alice")
+	// Retries must send the same body
+	endDate := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	createPoll := func(t *testing.T, key, title string) *Response {
+		t.Helper()
+		return h.Do(t, Request{
+			Method:  http.MethodPost,
+			Path:    "/api/polls",
+			Token:   user.AccessToken,
+			Headers: map[string]string{"Idempotency-Key": key},
+			Body: map[string]any{
+				"title":       title,
+				"description": "Created with an idempotency key",
+				"endDate":     endDate,
+				"options":     []map[string]string{{"text": "a"}, {"text": "b"}},
+			},
+		})
+	}
+
+	t.Run("Replay", func(t *testing.T) {
+		first := createPoll(t, "replay", "Replayed")
+		first.Expect(t, http.StatusCreated)
+		again := createPoll(t, "replay", "Replayed").Expect(t, http.StatusCreated)
+		if again.Header.Get("Idempotent-Replayed") != "true" || string(again.Body) != string(first.Body) {
+			t.Fatalf("retry was not replayed: %s", again.Body)
+		}
+		createPoll(t, "replay", "Different").Expect(t, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("PendingReservation", func(t *testing.T) {
+		createPoll(t, "pending", "Pending").Expect(t, http.StatusCreated)
+		record := h.DB.Model(&models.IdempotencyRecord{}).Where("key = ?", "pending")
+
+		// Without a stored response the original request is still being processed
+		if err := record.Session(&gorm.Session{}).UpdateColumn("status_code", 0).Error; err != nil {
+			t.Fatal(err)
+		}
+		createPoll(t, "pending", "Pending").Expect(t, http.StatusConflict)
+
+		// unless its process died mid-request long ago; then the key is free again
+		if err := record.Session(&gorm.Session{}).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error; err != nil {
+			t.Fatal(err)
+		}
+		createPoll(t, "pending", "Pending").Expect(t, http.StatusCreated)
+		replayed := createPoll(t, "pending", "Pending").Expect(t, http.StatusCreated)
+		if replayed.Header.Get("Idempotent-Replayed") != "true" {
+			t.Fatal("response of the request that took over the key was not stored")
+		}
+	})
+}
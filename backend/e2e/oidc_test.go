@@ -0,0 +1,157 @@
+package e2e
+
+import (
+	"net/http"
+	"net/url"
+	"pollingPlatform/models"
+	"pollingPlatform/oidc/oidctest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOIDC(t *testing.T) {
+	idp := oidctest.NewServer("polling-platform", "idp-secret")
+	t.Cleanup(idp.Close)
+	h := New(t, WithOIDC(idp, "admins=admin,mods=moderator,ghosts=ghost"))
+
+	me := func(t *testing.T, callback *Response) models.User {
+		t.Helper()
+		var tokens struct {
+			AccessToken string `json:"access_token"`
+		}
+		callback.Expect(t, http.StatusOK).JSON(t, &tokens)
+		var body struct {
+			User models.User `json:"user"`
+		}
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/me", Token: tokens.AccessToken}).Expect(t, http.StatusOK).JSON(t, &body)
+		return body.User
+	}
+
+	t.Run("PKCERoundTrip", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub-grace", Email: "grace@example.com", EmailVerified: true, PreferredUsername: "grace"})
+		authorize := h.oidcLogin(t)
+		if q := authorize.Query(); q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+			t.Fatalf("authorization request %s", authorize)
+		}
+
+		user := me(t, h.oidcCallback(t, authorize))
+		if user.Email != "grace@example.com" || user.Username != "grace" || user.Role != "user" {
+			t.Fatalf("signed in as %+v", user)
+		}
+		// The same identity signs in to the same account
+		if again := me(t, h.oidcCallback(t, h.oidcLogin(t))); again.ID != user.ID {
+			t.Fatalf("second login created account %d, want %d", again.ID, user.ID)
+		}
+	})
+
+	t.Run("InvalidState", func(t *testing.T) {
+		authorize := h.oidcLogin(t)
+		callback := h.oidcRedirect(t, authorize)
+		forged := url.Values{"code": {callback.Get("code")}, "state": {"forged"}}
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/auth/oidc/callback?" + forged.Encode()}).Expect(t, http.StatusBadRequest)
+
+		// States are single-use
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/auth/oidc/callback?" + callback.Encode()}).Expect(t, http.StatusOK)
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/auth/oidc/callback?" + callback.Encode()}).Expect(t, http.StatusBadRequest)
+	})
+
+	t.Run("NonceMismatch", func(t *testing.T) {
+		authorize := withParam(h.oidcLogin(t), "nonce", "replayed-nonce")
+		h.oidcCallback(t, authorize).Expect(t, http.StatusUnauthorized)
+	})
+
+	t.Run("WrongCodeVerifier", func(t *testing.T) {
+		authorize := withParam(h.oidcLogin(t), "code_challenge", strings.Repeat("A", 43))
+		h.oidcCallback(t, authorize).Expect(t, http.StatusUnauthorized)
+	})
+
+	t.Run("RoleMapping", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub-heidi", Email: "heidi@example.com", EmailVerified: true, Groups: []string{"staff", "mods"}})
+		if user := me(t, h.oidcCallback(t, h.oidcLogin(t))); user.Role != "moderator" {
+			t.Fatalf("role %q, want moderator", user.Role)
+		}
+
+		// With a mapping configured the IdP is authoritative, so group changes apply on the next login
+		idp.SetUser(oidctest.User{Subject: "sub-heidi", Email: "heidi@example.com", EmailVerified: true, Groups: []string{"admins", "mods"}})
+		if user := me(t, h.oidcCallback(t, h.oidcLogin(t))); user.Role != "admin" {
+			t.Fatalf("role %q after joining admins, want admin", user.Role)
+		}
+		idp.SetUser(oidctest.User{Subject: "sub-heidi", Email: "heidi@example.com", EmailVerified: true})
+		if user := me(t, h.oidcCallback(t, h.oidcLogin(t))); user.Role != "user" {
+			t.Fatalf("role %q without mapped groups, want user", user.Role)
+		}
+	})
+
+	t.Run("UnknownMappedRole", func(t *testing.T) {
+		// A mapping to an undefined role falls back to the default role
+		idp.SetUser(oidctest.User{Subject: "sub-ivan", Email: "ivan@example.com", EmailVerified: true, Groups: []string{"ghosts"}})
+		if user := me(t, h.oidcCallback(t, h.oidcLogin(t))); user.Role != "user" {
+			t.Fatalf("role %q from a mapping to an unknown role, want user", user.Role)
+		}
+	})
+}
+
+func TestOIDCRateLimit(t *testing.T) {
+	idp := oidctest.NewServer("polling-platform", "idp-secret")
+	t.Cleanup(idp.Close)
+	h := New(t, WithOIDC(idp, ""), WithRateLimit("login", 2, time.Minute))
+
+	h.oidcLogin(t)
+	h.oidcLogin(t)
+	h.Do(t, Request{Method: http.MethodGet, Path: "/api/auth/oidc/login"}).Expect(t, http.StatusTooManyRequests)
+	h.Do(t, Request{Method: http.MethodGet, Path: "/api/auth/oidc/callback?code=x&state=y"}).Expect(t, http.StatusTooManyRequests)
+}
+
+// noRedirects sends requests without following redirects
+var noRedirects = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+// oidcLogin starts a login and returns the authorization request URL at the IdP
+func (h *Harness) oidcLogin(t *testing.T) *url.URL {
+	t.Helper()
+	return redirect(t, h.Server.URL+"/api/auth/oidc/login")
+}
+
+// oidcRedirect sends the authorization request to the IdP and returns the query the
+// IdP redirects back to the callback with
+func (h *Harness) oidcRedirect(t *testing.T, authorize *url.URL) url.Values {
+	t.Helper()
+	location := redirect(t, authorize.String())
+	if !strings.HasPrefix(location.String(), OIDCRedirectURL+"?") {
+		t.Fatalf("IdP redirected to %s", location)
+	}
+	return location.Query()
+}
+
+// oidcCallback completes the login for authorize and returns the callback response
+func (h *Harness) oidcCallback(t *testing.T, authorize *url.URL) *Response {
+	t.Helper()
+	callback := h.oidcRedirect(t, authorize)
+	return h.Do(t, Request{Method: http.MethodGet, Path: "/api/auth/oidc/callback?" + callback.Encode()})
+}
+
+// withParam returns u with one query parameter replaced, as a tampering client would
+func withParam(u *url.URL, name, value string) *url.URL {
+	q := u.Query()
+	q.Set(name, value)
+	changed := *u
+	changed.RawQuery = q.Encode()
+	return &changed
+}
+
+func redirect(t *testing.T, target string) *url.URL {
+	t.Helper()
+	resp, err := noRedirects.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("GET %s: status %d, want a redirect", target, resp.StatusCode)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
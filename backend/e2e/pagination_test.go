@@ -0,0 +1,89 @@
+package e2e
+
+import (
+	"net/http"
+	"pollingPlatform/models"
+	"pollingPlatform/repository/storetest"
+	"testing"
+	"time"
+)
+
+type pollPage struct {
+	Polls      []models.Poll `json:"polls"`
+	Pagination struct {
+		CurrentPage int   `json:"current_page"`
+		PerPage     int   `json:"per_page"`
+		TotalItems  int64 `json:"total_items"`
+		TotalPages  int64 `json:"total_pages"`
+	} `json:"pagination"`
+}
+
+func TestPagination(t *testing.T) {
+	h := New(t)
+	owner := h.Register(t, "owner")
+
+	// 7 active and 3 ended polls, created directly to stay clear of the plan quota
+	for i := 0; i < 10; i++ {
+		d := time.Hour
+		if i >= 7 {
+			d = -time.Hour
+		}
+		if err := h.Deps.Polls.CreatePoll(storetest.NewPoll(owner.ID, d, "a", "b")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query string) pollPage {
+		t.Helper()
+		var page pollPage
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/polls" + query}).Expect(t, http.StatusOK).JSON(t, &page)
+		return page
+	}
+
+	tests := []struct {
+		query             string
+		page, perPage     int
+		items, total, pgs int64
+	}{
+		{"", 1, 10, 10, 10, 1},
+		{"?limit=4", 1, 4, 4, 10, 3},
+		{"?limit=4&page=3", 3, 4, 2, 10, 3},
+		{"?limit=4&page=4", 4, 4, 0, 10, 3},
+		{"?status=active&limit=5", 1, 5, 5, 7, 2},
+		{"?status=ended", 1, 10, 3, 3, 1},
+		{"?page=0&limit=500", 1, 10, 10, 10, 1},
+	}
+	for _, tt := range tests {
+		page := list(tt.query)
+		p := page.Pagination
+		if p.CurrentPage != tt.page || p.PerPage != tt.perPage || int64(len(page.Polls)) != tt.items ||
+			p.TotalItems != tt.total || p.TotalPages != tt.pgs {
+			t.Errorf("%q: page %d, per page %d, %d polls, %d total, %d pages", tt.query,
+				p.CurrentPage, p.PerPage, len(page.Polls), p.TotalItems, p.TotalPages)
+		}
+	}
+
+	t.Run("PagesDontOverlap", func(t *testing.T) {
+		seen := map[uint]bool{}
+		for _, query := range []string{"?limit=4&page=1", "?limit=4&page=2", "?limit=4&page=3"} {
+			for _, poll := range list(query).Polls {
+				if seen[poll.ID] {
+					t.Fatalf("poll %d listed twice", poll.ID)
+				}
+				seen[poll.ID] = true
+			}
+		}
+		if len(seen) != 10 {
+			t.Fatalf("saw %d polls, want 10", len(seen))
+		}
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+		resp := h.Do(t, Request{Method: http.MethodGet, Path: "/api/polls?limit=4"}).Expect(t, http.StatusOK)
+		h.Do(t, Request{
+			Method:  http.MethodGet,
+			Path:    "/api/polls?limit=4",
+			Headers: map[string]string{"If-None-Match": resp.Header.Get("ETag")},
+		}).Expect(t, http.StatusNotModified)
+	})
+}
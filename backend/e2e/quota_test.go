@@ -0,0 +1,49 @@
+package e2e
+
+import (
+	"net/http"
+	"pollingPlatform/quota"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallelPollCreationStaysWithinQuota(t *testing.T) {
+	h := New(t)
+	owner := h.Register(t, "owner")
+
+	limit := quota.BuiltInPlans[0].MaxActivePolls
+	attempts := limit * 3
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- h.Do(t, Request{
+				Method: http.MethodPost,
+				Path:   "/api/polls",
+				Token:  owner.AccessToken,
+				Body: map[string]any{
+					"title":       "Parallel",
+					"description": "Created concurrently",
+					"endDate":     time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+					"options":     []map[string]string{{"text": "a"}, {"text": "b"}},
+				},
+			}).Status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != limit || counts[http.StatusForbidden] != attempts-limit {
+		t.Fatalf("statuses %v, want %d created and the rest forbidden", counts, limit)
+	}
+	if n, err := h.Deps.Polls.CountActivePollsByUser(owner.ID); err != nil || int(n) != limit {
+		t.Fatalf("%d active polls (%v), want %d", n, err, limit)
+	}
+}
@@ -0,0 +1,33 @@
+package e2e
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	h := New(t, WithRateLimit("poll-read", 3, time.Minute))
+	owner := h.Register(t, "owner")
+	poll := h.CreatePoll(t, owner, "Lunch", "pizza", "sushi")
+	path := "/api/polls/" + strconv.FormatUint(uint64(poll.ID), 10)
+
+	for i := 0; i < 3; i++ {
+		resp := h.Do(t, Request{Method: http.MethodGet, Path: path}).Expect(t, http.StatusOK)
+		if got, want := resp.Header.Get("RateLimit-Remaining"), strconv.Itoa(2-i); got != want {
+			t.Fatalf("request %d: RateLimit-Remaining %q, want %q", i, got, want)
+		}
+	}
+
+	resp := h.Do(t, Request{Method: http.MethodGet, Path: path}).Expect(t, http.StatusTooManyRequests)
+	if retry, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retry < 1 {
+		t.Fatalf("Retry-After %q", resp.Header.Get("Retry-After"))
+	}
+	if resp.Header.Get("RateLimit-Limit") != "3" {
+		t.Fatalf("RateLimit-Limit %q", resp.Header.Get("RateLimit-Limit"))
+	}
+
+	// Other policies have their own budget
+	h.Do(t, Request{Method: http.MethodGet, Path: "/api/polls"}).Expect(t, http.StatusOK)
+}
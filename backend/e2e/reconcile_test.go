@@ -0,0 +1,38 @@
+package e2e
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReconcileFailureIsGeneric(t *testing.T) {
+	h := New(t)
+	admin := h.Register(t, "admin")
+	h.SetRole(t, admin, "admin")
+
+	// Break the ballot query so the run fails inside the driver
+	if err := h.DB.Exec("ALTER TABLE votes RENAME TO votes_moved").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, resp := range []*Response{
+		h.Do(t, Request{Method: http.MethodPost, Path: "/api/admin/reconciliation", Token: admin.AccessToken}).
+			Expect(t, http.StatusInternalServerError),
+		h.Do(t, Request{Method: http.MethodGet, Path: "/api/admin/reconciliation", Token: admin.AccessToken}).
+			Expect(t, http.StatusOK),
+	} {
+		if strings.Contains(string(resp.Body), "votes") {
+			t.Fatalf("response exposes the database error: %s", resp.Body)
+		}
+		var body struct {
+			Report struct {
+				Error string `json:"error"`
+			} `json:"report"`
+		}
+		resp.JSON(t, &body)
+		if body.Report.Error != "reconciliation failed" {
+			t.Fatalf("report error %q", body.Report.Error)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"pollingPlatform/health"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyLimit(t *testing.T) {
+	h := New(t)
+	user := h.Register(t, "alice")
+
+	h.Do(t, Request{
+		Method: http.MethodPost,
+		Path:   "/api/polls",
+		Token:  user.AccessToken,
+		Body:   map[string]string{"title": strings.Repeat("x", MaxBodyBytes)},
+	}).Expect(t, http.StatusRequestEntityTooLarge)
+
+	// Without a Content-Length the body is sent chunked and only the read hits the limit
+	body := io.MultiReader(strings.NewReader(`{"title":"`), strings.NewReader(strings.Repeat("x", MaxBodyBytes)), strings.NewReader(`"}`))
+	req, err := http.NewRequest(http.MethodPost, h.Server.URL+"/api/polls", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+user.AccessToken)
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("chunked body over the limit: status %d", resp.StatusCode)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	h := New(t, WithRateLimit("poll-list", 1, time.Minute))
+	owner := h.Register(t, "owner")
+	poll := h.CreatePoll(t, owner, "Metrics", "a", "b")
+	h.Vote(t, owner, poll.ID, 0).Expect(t, http.StatusOK)
+	h.Do(t, Request{Method: http.MethodGet, Path: "/api/polls"}).Expect(t, http.StatusOK)
+	h.Do(t, Request{Method: http.MethodGet, Path: "/api/polls"}).Expect(t, http.StatusTooManyRequests)
+	h.Do(t, Request{
+		Method: http.MethodPost,
+		Path:   "/api/login",
+		Body:   map[string]string{"email": owner.Email, "password": "wrong"},
+	}).Expect(t, http.StatusUnauthorized)
+
+	resp := h.Do(t, Request{Method: http.MethodGet, Path: "/metrics"}).Expect(t, http.StatusOK)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("content type %q", resp.Header.Get("Content-Type"))
+	}
+	body := string(resp.Body)
+	for _, series := range []string{
+		`http_request_duration_seconds_count{method="POST",route="/api/polls/:id/vote",status="200"}`,
+		`votes_recorded_total{poll_type="standard"}`,
+		`rate_limit_rejections_total{policy="poll-list"}`,
+		`login_failures_total{reason="wrong_password"}`,
+	} {
+		if !strings.Contains(body, series) {
+			t.Errorf("missing %s", series)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	h := New(t)
+
+	h.Do(t, Request{Method: http.MethodGet, Path: "/healthz"}).Expect(t, http.StatusOK)
+
+	var report health.Report
+	h.Do(t, Request{Method: http.MethodGet, Path: "/readyz"}).Expect(t, http.StatusOK).JSON(t, &report)
+	if report.Status != health.Ready || report.Checks["database"].Status != health.StatusOK || report.Checks["migrations"].Status != health.StatusOK {
+		t.Fatalf("report %+v", report)
+	}
+
+	h.Deps.Health.Drain()
+	h.Do(t, Request{Method: http.MethodGet, Path: "/readyz"}).Expect(t, http.StatusServiceUnavailable).JSON(t, &report)
+	if report.Status != health.ShuttingDown {
+		t.Fatalf("status %q while draining", report.Status)
+	}
+	h.Do(t, Request{Method: http.MethodGet, Path: "/healthz"}).Expect(t, http.StatusOK)
+}
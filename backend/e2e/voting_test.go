@@ -0,0 +1,66 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"pollingPlatform/repository/storetest"
+	"testing"
+	"time"
+)
+
+func TestVoting(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"SQLite": nil,
+		"Memory": {WithMemoryStores()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := New(t, opts...)
+			owner := h.Register(t, "owner")
+			voter := h.Register(t, "voter")
+			poll := h.CreatePoll(t, owner, "Favourite colour", "red", "green", "blue")
+
+			t.Run("Counts", func(t *testing.T) {
+				h.Vote(t, voter, poll.ID, 1).Expect(t, http.StatusOK)
+				h.Vote(t, owner, poll.ID, 1).Expect(t, http.StatusOK)
+
+				got := h.GetPoll(t, poll.ID)
+				for i, want := range []int{0, 2, 0} {
+					if got.Options[i].Votes != want {
+						t.Fatalf("option %d has %d votes, want %d", i, got.Options[i].Votes, want)
+					}
+				}
+			})
+
+			t.Run("OnlyOnce", func(t *testing.T) {
+				h.Vote(t, voter, poll.ID, 2).Expect(t, http.StatusConflict)
+			})
+
+			t.Run("InvalidOption", func(t *testing.T) {
+				other := h.Register(t, "other")
+				h.Vote(t, other, poll.ID, 3).Expect(t, http.StatusBadRequest)
+				h.Vote(t, other, poll.ID, -1).Expect(t, http.StatusBadRequest)
+			})
+
+			t.Run("UnknownPoll", func(t *testing.T) {
+				h.Vote(t, voter, poll.ID+1000, 0).Expect(t, http.StatusNotFound)
+			})
+
+			t.Run("EndedPoll", func(t *testing.T) {
+				ended := storetest.NewPoll(owner.ID, -time.Minute, "yes", "no")
+				if err := h.Deps.Polls.CreatePoll(ended); err != nil {
+					t.Fatal(err)
+				}
+				late := h.Register(t, "late")
+				h.Vote(t, late, ended.ID, 0).Expect(t, http.StatusBadRequest)
+			})
+
+			t.Run("RequiresLogin", func(t *testing.T) {
+				h.Do(t, Request{
+					Method: http.MethodPost,
+					Path:   fmt.Sprintf("/api/polls/%d/vote", poll.ID),
+					Body:   map[string]int{"option_index": 0},
+				}).Expect(t, http.StatusUnauthorized)
+			})
+		})
+	}
+}
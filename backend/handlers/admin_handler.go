@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pollingPlatform/middleware"
+	"pollingPlatform/models"
+	"pollingPlatform/rbac"
+	"pollingPlatform/repository"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{1,29}$`)
+
+type AdminHandler struct {
+	guard *middleware.LoginGuard
+	authz *rbac.Authorizer
+	roles *repository.RoleRepository
+	users repository.UserStore
+}
+
+func NewAdminHandler(guard *middleware.LoginGuard, authz *rbac.Authorizer, roles *repository.RoleRepository, users repository.UserStore) *AdminHandler {
+	return &AdminHandler{guard: guard, authz: authz, roles: roles, users: users}
+}
+
+func (h *AdminHandler) ListLockouts(c *gin.Context) {
+	lockouts := h.guard.Lockouts()
+	if lockouts == nil {
+		lockouts = []middleware.LockoutStatus{}
+	}
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts})
+}
+
+func (h *AdminHandler) ClearLockout(c *gin.Context) {
+	kind := c.Param("kind")
+	if kind != middleware.LockoutKindAccount && kind != middleware.LockoutKindIP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kind must be 'account' or 'ip'"})
+		return
+	}
+
+	if !h.guard.Clear(kind, c.Param("subject")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No failed logins recorded for this " + kind})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Lockout cleared",
+	})
+}
+
+func (h *AdminHandler) ListPermissions(c *gin.Context) {
+	permissions, err := h.roles.ListPermissions()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roles.ListRoles()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (h *AdminHandler) CreateRole(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description" binding:"max=200"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if !roleNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Validation failed",
+			"details": "role name must be 2-30 lowercase letters, digits or dashes",
+		})
+		return
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !h.authz.CanGrant(c.GetString("userRole"), req.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status": "error",
+			"error":  "You cannot grant permissions you don't have",
+		})
+		return
+	}
+
+	if _, err := h.roles.GetRoleByName(name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"status": "error",
+			"error":  "Role already exists",
+		})
+		return
+	}
+
+	role := models.Role{Name: name, Description: strings.TrimSpace(req.Description)}
+	if err := h.roles.CreateRole(&role, req.Permissions); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to create role",
+		})
+		return
+	}
+	h.reloadRoles()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Role created successfully",
+		"data":    role,
+	})
+}
+
+func (h *AdminHandler) SetRolePermissions(c *gin.Context) {
+	var req struct {
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !h.authz.CanGrant(c.GetString("userRole"), req.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status": "error",
+			"error":  "You cannot grant permissions you don't have",
+		})
+		return
+	}
+
+	role, err := h.roles.GetRoleByName(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if role.Name == rbac.AdminRole {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "error",
+			"error":  "The admin role always has every permission",
+		})
+		return
+	}
+	// Taking permissions away counts too, so the role may not hold more than the caller
+	if !h.authz.CanGrantRole(c.GetString("userRole"), role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status": "error",
+			"error":  "You cannot change a role with permissions you don't have",
+		})
+		return
+	}
+
+	if err := h.roles.SetRolePermissions(role, req.Permissions); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to update role",
+		})
+		return
+	}
+	h.reloadRoles()
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Role updated successfully",
+		"data":    role,
+	})
+}
+
+// AssignRole changes a user's role. The change is based on the version of the user
+// the permission checks were made against, so it fails rather than overwrite a change
+// made in between. Clients may send If-Match with the version they looked at.
+func (h *AdminHandler) AssignRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !h.authz.RoleExists(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "error",
+			"error":  "Unknown role",
+		})
+		return
+	}
+
+	callerRole := c.GetString("userRole")
+	if !h.authz.CanGrantRole(callerRole, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status": "error",
+			"error":  "You cannot assign a role with permissions you don't have",
+		})
+		return
+	}
+
+	// Prevent admins from accidentally locking themselves out
+	if uint(id) == c.GetUint("userID") && req.Role != rbac.AdminRole && callerRole == rbac.AdminRole {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "error",
+			"error":  "You cannot remove your own admin role",
+		})
+		return
+	}
+
+	user, err := h.users.GetUserByID(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch != "" && !ifMatchSatisfied(ifMatch, user.Version) {
+		respondUserConflict(c, http.StatusPreconditionFailed, user)
+		return
+	}
+
+	// Nor may they demote someone who holds more than they do
+	if !h.authz.CanGrantRole(callerRole, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status": "error",
+			"error":  "You cannot change the role of a user with permissions you don't have",
+		})
+		return
+	}
+
+	err = h.users.UpdateRole(user.ID, req.Role, user.Version)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		// The user changed since the checks above, possibly to a role the caller
+		// may not touch
+		respondUserChanged(c, h.users, ifMatch, user.ID)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to assign role",
+		})
+		return
+	}
+
+	user.Version++
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Role assigned. It takes effect when the user's token is next refreshed.",
+	})
+}
+
+// respondUserConflict reports that the user isn't at the version the client named
+func respondUserConflict(c *gin.Context, status int, current *models.User) {
+	c.Header("ETag", userETag(current))
+	c.JSON(status, gin.H{
+		"status":  "error",
+		"error":   "User was modified by someone else",
+		"version": current.Version,
+	})
+}
+
+// respondUserChanged answers an update that lost a race with another one: 412 if the
+// client sent If-Match, 409 otherwise, as for poll edits
+func respondUserChanged(c *gin.Context, users repository.UserStore, ifMatch string, userID uint) {
+	status := http.StatusConflict
+	if ifMatch != "" {
+		status = http.StatusPreconditionFailed
+	}
+	current, err := users.GetUserByID(userID)
+	if err != nil {
+		c.JSON(status, gin.H{"status": "error", "error": "User was modified concurrently"})
+		return
+	}
+	respondUserConflict(c, status, current)
+}
+
+func (h *AdminHandler) reloadRoles() {
+	// The periodic reload will catch up if this fails
+	_ = h.authz.Reload()
+}
+
+func validatePermissions(permissions []string) error {
+	for _, p := range permissions {
+		if !rbac.IsKnownPermission(p) {
+			return errors.New("unknown permission: " + p)
+		}
+	}
+	return nil
+}
@@ -1,28 +1,47 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
-	"os"
+	"pollingPlatform/metrics"
 	"pollingPlatform/middleware"
 	"pollingPlatform/models"
+	"pollingPlatform/rbac"
 	"pollingPlatform/repository"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+var loginFailures = metrics.Default.NewCounterVec("login_failures_total",
+	"Rejected password logins by reason (unknown_account, wrong_password, locked or throttled).", "reason")
+
 type AuthHandler struct {
-	repo *repository.UserRepository
+	repo   repository.UserStore
+	guard  *middleware.LoginGuard
+	tokens *middleware.JWTService
+}
+
+func NewAuthHandler(repo repository.UserStore, guard *middleware.LoginGuard, tokens *middleware.JWTService) *AuthHandler {
+	return &AuthHandler{repo: repo, guard: guard, tokens: tokens}
 }
 
-func NewAuthHandler(repo *repository.UserRepository) *AuthHandler {
-	return &AuthHandler{repo: repo}
+// users returns the store bound to the request context
+func (h *AuthHandler) users(c *gin.Context) repository.UserStore {
+	return h.repo.WithContext(c.Request.Context())
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	// Roles are assigned by admins, so the payload deliberately has no role field
+	var req struct {
+		Username string `json:"username" binding:"required,min=3,max=30"`
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
 			"error":   "Invalid request format",
@@ -31,6 +50,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	user := models.User{
+		Username: req.Username,
+		Email:    req.Email,
+		Password: req.Password,
+		Role:     rbac.DefaultRole,
+	}
+
 	// Validate user data
 	if err := user.ValidateUser(); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -42,7 +68,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Check if email already exists
-	existingUser, err := h.repo.GetUserByEmail(user.Email)
+	existingUser, err := h.users(c).GetUserByEmail(user.Email)
 	if err == nil && existingUser != nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"status": "error",
@@ -52,7 +78,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Check if username already exists
-	existingUser, err = h.repo.GetUserByUsername(user.Username)
+	existingUser, err = h.users(c).GetUserByUsername(user.Username)
 	if err == nil && existingUser != nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"status": "error",
@@ -64,6 +90,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status": "error",
 			"error":  "Failed to hash password",
@@ -72,17 +99,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 	user.Password = string(hashedPassword)
 
-	// Set default role
-	if user.Role == "" {
-		user.Role = "user"
-	}
-
 	// Create user
-	if err := h.repo.CreateUser(&user); err != nil {
+	if err := h.users(c).CreateUser(&user); err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"error":   "Failed to create user",
-			"details": err.Error(),
+			"status": "error",
+			"error":  "Failed to create user",
 		})
 		return
 	}
@@ -104,19 +126,46 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.repo.GetUserByEmail(credentials.Email)
-	if err != nil {
+	ip := c.ClientIP()
+	attempt, wait, locked := h.guard.Begin(ip, credentials.Email)
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		if locked {
+			loginFailures.WithLabelValues("locked").Inc()
+			c.JSON(http.StatusLocked, gin.H{"error": "Too many failed login attempts. Account temporarily locked."})
+			return
+		}
+		loginFailures.WithLabelValues("throttled").Inc()
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts. Please try again later."})
+		return
+	}
+
+	user, err := h.users(c).GetUserByEmail(credentials.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		loginFailures.WithLabelValues("unknown_account").Inc()
+		attempt.Failed()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	if err != nil {
+		// Only wrong credentials count against the account and IP
+		attempt.Release()
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)); err != nil {
+		loginFailures.WithLabelValues("wrong_password").Inc()
+		attempt.Failed()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	attempt.Succeeded()
 
-	accessToken, refreshToken, err := middleware.GenerateTokens(user.ID, user.Role)
+	accessToken, refreshToken, err := h.tokens.GenerateTokens(user.ID, user.Role)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 		return
 	}
@@ -138,19 +187,23 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	// Parse the refresh token
-	claims := &middleware.Claims{}
-	token, err := jwt.ParseWithClaims(req.RefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	claims, err := h.tokens.ParseToken(req.RefreshToken, middleware.TokenTypeRefresh)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
 
-	if err != nil || !token.Valid {
+	// Use the current role so role changes apply from the next refresh
+	user, err := h.users(c).GetUserByID(claims.UserID)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
 	// Generate new tokens
-	accessToken, refreshToken, err := middleware.GenerateTokens(claims.UserID, claims.Role)
+	accessToken, refreshToken, err := h.tokens.GenerateTokens(user.ID, user.Role)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
 		return
 	}
@@ -168,7 +221,7 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 		return
 	}
 
-	user, err := h.repo.GetUserByID(userID.(uint))
+	user, err := h.users(c).GetUserByID(userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
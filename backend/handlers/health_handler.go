@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"pollingPlatform/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Live answers as long as the process is serving requests
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready reports every dependency and answers 503 when the service should not get
+// traffic, including while it shuts down
+func (h *HealthHandler) Ready(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	report := h.checker.Ready(c.Request.Context())
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
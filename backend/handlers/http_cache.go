@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"pollingPlatform/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cache-Control values for poll reads. Active polls change with every vote, so clients
+// must revalidate; ended polls only change if an admin repairs their counters.
+const (
+	cacheControlActive = "public, no-cache"
+	cacheControlEnded  = "public, max-age=86400"
+)
+
+// pollETag is a strong validator covering everything a vote or edit can change. It
+// starts with the poll's version, which is all If-Match compares.
+func pollETag(poll *models.Poll) string {
+	h := sha256.New()
+	writePollState(h, poll)
+	return fmt.Sprintf(`"v%d-%s"`, poll.Version, hex.EncodeToString(h.Sum(nil)[:16]))
+}
+
+// pollListETag changes whenever any poll on the page does, or the total does
+func pollListETag(page, limit int, status string, total int64, polls []models.Poll) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%d|%s|%d\n", page, limit, status, total)
+	for i := range polls {
+		writePollState(h, &polls[i])
+	}
+	return quoteETag(h)
+}
+
+func writePollState(h hash.Hash, poll *models.Poll) {
+	fmt.Fprintf(h, "%d|%d|%d|%t|", poll.ID, poll.Version, poll.UpdatedAt.UnixNano(), poll.HighTraffic)
+	for _, o := range poll.Options {
+		fmt.Fprintf(h, "%d:%d:%d,", o.ID, o.Votes, o.UpdatedAt.UnixNano())
+	}
+	h.Write([]byte{'\n'})
+}
+
+func quoteETag(h hash.Hash) string {
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// pollLastModified is the latest change to an ended poll. Active polls don't get one,
+// because sharded votes change totals without touching any timestamp.
+func pollLastModified(poll *models.Poll) time.Time {
+	modified := poll.UpdatedAt
+	if poll.EndDate.After(modified) {
+		modified = poll.EndDate
+	}
+	for _, o := range poll.Options {
+		if o.UpdatedAt.After(modified) {
+			modified = o.UpdatedAt
+		}
+	}
+	return modified
+}
+
+// checkNotModified sets the validators on the response and answers 304 when the
+// client's copy is current. It reports whether the response has been written.
+func checkNotModified(c *gin.Context, etag string, lastModified time.Time, cacheControl string) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence; If-Modified-Since is only used without it
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		if etagMatches(inm, etag) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err == nil && !lastModified.Truncate(time.Second).After(since) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatches applies the weak comparison If-None-Match calls for
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchSatisfied reports whether If-Match names version with a strong tag: an ETag
+// the resource was served with or "v<version>". Only the version is compared: votes
+// change a poll's ETag but are not edits, so they must not fail the precondition. "*"
+// and weak tags are rejected, since a write must name the exact version it is based on.
+func ifMatchSatisfied(header string, version uint) bool {
+	want := "v" + strconv.FormatUint(uint64(version), 10)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if len(candidate) < 2 || candidate[0] != '"' || candidate[len(candidate)-1] != '"' {
+			continue
+		}
+		tagVersion, _, _ := strings.Cut(candidate[1:len(candidate)-1], "-")
+		if tagVersion == want {
+			return true
+		}
+	}
+	return false
+}
+
+// userETag names a user's version, for the If-Match of role and plan changes
+func userETag(user *models.User) string {
+	return fmt.Sprintf(`"v%d"`, user.Version)
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+	"pollingPlatform/keys"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	keys *keys.Manager
+}
+
+func NewJWKSHandler(km *keys.Manager) *JWKSHandler {
+	return &JWKSHandler{keys: km}
+}
+
+// GetJWKS publishes the public keys used to verify our JWTs
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"pollingPlatform/logging"
+	"pollingPlatform/middleware"
+	"pollingPlatform/models"
+	"pollingPlatform/oidc"
+	"pollingPlatform/rbac"
+	"pollingPlatform/repository"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type OIDCHandler struct {
+	provider *oidc.Provider
+	repo     repository.UserStore
+	states   *oidc.StateStore
+	tokens   *middleware.JWTService
+	authz    *rbac.Authorizer
+	// syncRoles makes the IdP group mapping authoritative on every login
+	syncRoles bool
+	// frontendURL, when set, receives the tokens in the URL fragment instead of a JSON body
+	frontendURL string
+}
+
+func NewOIDCHandler(provider *oidc.Provider, repo repository.UserStore, states *oidc.StateStore, tokens *middleware.JWTService, authz *rbac.Authorizer, syncRoles bool, frontendURL string) *OIDCHandler {
+	return &OIDCHandler{
+		provider:    provider,
+		repo:        repo,
+		states:      states,
+		tokens:      tokens,
+		authz:       authz,
+		syncRoles:   syncRoles,
+		frontendURL: frontendURL,
+	}
+}
+
+// Login starts the authorization-code flow by redirecting to the identity provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	h.states.Save(state, oidc.PendingLogin{Nonce: nonce, CodeVerifier: verifier})
+
+	c.Redirect(http.StatusFound, h.provider.AuthCodeURL(state, nonce, oidc.S256Challenge(verifier)))
+}
+
+// Callback completes the flow, links or creates the local user and issues our tokens
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  "error",
+			"error":   "Identity provider rejected the login",
+			"details": errCode,
+		})
+		return
+	}
+
+	pending, ok := h.states.Take(c.Query("state"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "error",
+			"error":  "Invalid or expired login state",
+		})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "error",
+			"error":  "Missing authorization code",
+		})
+		return
+	}
+
+	identity, err := h.provider.Exchange(c.Request.Context(), code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status": "error",
+			"error":  "Failed to verify identity",
+		})
+		return
+	}
+
+	user, err := h.resolveUser(identity, h.role(c, identity))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to sign in user",
+		})
+		return
+	}
+
+	accessToken, refreshToken, err := h.tokens.GenerateTokens(user.ID, user.Role)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		return
+	}
+
+	if h.frontendURL != "" {
+		fragment := url.Values{}
+		fragment.Set("access_token", accessToken)
+		fragment.Set("refresh_token", refreshToken)
+		c.Redirect(http.StatusFound, h.frontendURL+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	})
+}
+
+// role maps the identity's groups to a role. A mapping to a role that isn't defined
+// is a configuration mistake, so such users get the default role instead.
+func (h *OIDCHandler) role(c *gin.Context, identity *oidc.Identity) string {
+	role := h.provider.Role(identity)
+	if !h.authz.RoleExists(role) {
+		logging.FromContext(c.Request.Context()).Warn("OIDC role mapping names an unknown role, using the default role",
+			"role", role, "subject", identity.Subject)
+		return rbac.DefaultRole
+	}
+	return role
+}
+
+// resolveUser finds the user linked to the identity, links an existing account with
+// the same verified email, or creates a new account, giving it role
+func (h *OIDCHandler) resolveUser(identity *oidc.Identity, role string) (*models.User, error) {
+	user, err := h.repo.GetUserByOIDCIdentity(identity.Issuer, identity.Subject)
+	if err == nil {
+		if h.syncRoles && user.Role != role {
+			user.Role = role
+			if err := h.repo.UpdateUser(user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Only trust the email for linking when the provider has verified it
+	if identity.Email != "" && identity.EmailVerified {
+		user, err := h.repo.GetUserByEmail(identity.Email)
+		if err == nil {
+			user.OIDCIssuer = identity.Issuer
+			user.OIDCSubject = identity.Subject
+			if h.syncRoles {
+				user.Role = role
+			}
+			if err := h.repo.UpdateUser(user); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if identity.Email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+
+	username, err := h.availableUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	// OIDC users sign in through the provider, so the local password is unguessable
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(secret)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user = &models.User{
+		Username:    username,
+		Email:       identity.Email,
+		Password:    string(hashedPassword),
+		Role:        role,
+		OIDCIssuer:  identity.Issuer,
+		OIDCSubject: identity.Subject,
+	}
+	if err := h.repo.CreateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// availableUsername derives a valid, unused username from the identity claims
+func (h *OIDCHandler) availableUsername(identity *oidc.Identity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = strings.Map(func(r rune) rune {
+		if strings.ContainsRune("<>{}[]@ ", r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(base))
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for i := 1; i <= 100; i++ {
+		if _, err := h.repo.GetUserByUsername(candidate); errors.Is(err, gorm.ErrRecordNotFound) {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	return "", errors.New("could not find an available username")
+}
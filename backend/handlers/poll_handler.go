@@ -1,20 +1,32 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"pollingPlatform/models"
+	"pollingPlatform/quota"
+	"pollingPlatform/rbac"
 	"pollingPlatform/repository"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type PollHandler struct {
-	repo *repository.PollRepository
+	repo   repository.PollStore
+	quotas *quota.Service
+	authz  *rbac.Authorizer
 }
 
-func NewPollHandler(repo *repository.PollRepository) *PollHandler {
-	return &PollHandler{repo: repo}
+func NewPollHandler(repo repository.PollStore, quotas *quota.Service, authz *rbac.Authorizer) *PollHandler {
+	return &PollHandler{repo: repo, quotas: quotas, authz: authz}
+}
+
+// polls returns the store bound to the request context
+func (h *PollHandler) polls(c *gin.Context) repository.PollStore {
+	return h.repo.WithContext(c.Request.Context())
 }
 
 func (h *PollHandler) CreatePoll(c *gin.Context) {
@@ -38,17 +50,41 @@ func (h *PollHandler) CreatePoll(c *gin.Context) {
 		return
 	}
 
-	// Initialize votes to 0
+	// Check the plan's option limit; the active poll limit is checked as the poll is created
+	userID := c.GetUint("userID")
+	quotaCheck, err := h.quotas.WithContext(c.Request.Context()).PollCreationCheck(userID, len(poll.Options))
+	if err != nil {
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			respondQuotaExceeded(c, exceeded)
+			return
+		}
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to check quota",
+		})
+		return
+	}
+
+	// Initialize votes to 0; only admins can mark a poll as high traffic
+	poll.UserID = userID
+	poll.HighTraffic = false
 	for i := range poll.Options {
 		poll.Options[i].Votes = 0
 	}
 
 	// Create poll
-	if err := h.repo.CreatePoll(&poll); err != nil {
+	if err := h.polls(c).CreatePollWithin(&poll, quotaCheck); err != nil {
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			respondQuotaExceeded(c, exceeded)
+			return
+		}
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"error":   "Failed to create poll",
-			"details": err.Error(),
+			"status": "error",
+			"error":  "Failed to create poll",
 		})
 		return
 	}
@@ -60,6 +96,136 @@ func (h *PollHandler) CreatePoll(c *gin.Context) {
 	})
 }
 
+// UpdatePoll edits a poll's title, description and end date until the poll ends. The
+// client must name the version it edited, either as If-Match with the poll's ETag or as
+// a "version" field, so concurrent edits can't silently overwrite each other.
+func (h *PollHandler) UpdatePoll(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req struct {
+		Title       string    `json:"title" binding:"required"`
+		Description string    `json:"description" binding:"required"`
+		EndDate     time.Time `json:"endDate" binding:"required"`
+		Version     *uint     `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" && req.Version == nil {
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"status": "error",
+			"error":  "An If-Match header or version field is required",
+		})
+		return
+	}
+
+	poll, err := h.polls(c).GetPollByIDUncached(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+		return
+	}
+
+	if poll.UserID != c.GetUint("userID") && !h.authz.Can(c.GetString("userRole"), rbac.PermPollsManage) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status": "error",
+			"error":  "You can only edit your own polls",
+		})
+		return
+	}
+
+	if ifMatch != "" {
+		if !ifMatchSatisfied(ifMatch, poll.Version) {
+			respondVersionConflict(c, http.StatusPreconditionFailed, poll)
+			return
+		}
+	} else if *req.Version != poll.Version {
+		respondVersionConflict(c, http.StatusConflict, poll)
+		return
+	}
+
+	// Results are final once a poll ends; moving the end date would reopen voting
+	if !poll.IsActive() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "error",
+			"error":  "Poll has ended",
+		})
+		return
+	}
+
+	edited := *poll
+	edited.Title = strings.TrimSpace(req.Title)
+	edited.Description = strings.TrimSpace(req.Description)
+	edited.EndDate = req.EndDate
+	if err := edited.ValidateDetails(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	err = h.polls(c).UpdatePollDetails(&edited)
+	switch {
+	case errors.Is(err, repository.ErrVersionConflict):
+		// Someone saved between our read and write
+		status := http.StatusConflict
+		if ifMatch != "" {
+			status = http.StatusPreconditionFailed
+		}
+		current, err := h.polls(c).GetPollByIDUncached(uint(id))
+		if err != nil {
+			c.JSON(status, gin.H{"status": "error", "error": "Poll was modified concurrently"})
+			return
+		}
+		respondVersionConflict(c, status, current)
+		return
+	case errors.Is(err, repository.ErrPollNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+		return
+	case err != nil:
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to update poll",
+		})
+		return
+	}
+
+	updated, err := h.polls(c).GetPollByIDUncached(uint(id))
+	if err != nil {
+		updated = &edited
+	}
+	c.Header("ETag", pollETag(updated))
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Poll updated successfully",
+		"data":    updated,
+	})
+}
+
+// respondVersionConflict rejects a stale edit and returns the current poll so the
+// client can merge its changes and retry
+func respondVersionConflict(c *gin.Context, status int, current *models.Poll) {
+	c.Header("ETag", pollETag(current))
+	c.JSON(status, gin.H{
+		"status":  "error",
+		"error":   "Poll was modified by someone else",
+		"current": current,
+	})
+}
+
 func (h *PollHandler) GetPoll(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -67,12 +233,22 @@ func (h *PollHandler) GetPoll(c *gin.Context) {
 		return
 	}
 
-	poll, err := h.repo.GetPollByID(uint(id))
+	poll, err := h.polls(c).GetPollByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
 		return
 	}
 
+	var lastModified time.Time
+	cacheControl := cacheControlActive
+	if !poll.IsActive() {
+		lastModified = pollLastModified(poll)
+		cacheControl = cacheControlEnded
+	}
+	if checkNotModified(c, pollETag(poll), lastModified, cacheControl) {
+		return
+	}
+
 	c.JSON(http.StatusOK, poll)
 }
 
@@ -94,15 +270,19 @@ func (h *PollHandler) ListPolls(c *gin.Context) {
 	offset := (page - 1) * limit
 
 	// Get total count and polls
-	polls, total, err := h.repo.ListPolls(offset, limit, status)
+	polls, total, err := h.polls(c).ListPolls(offset, limit, status)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch polls",
-			"details": err.Error(),
+			"error": "Failed to fetch polls",
 		})
 		return
 	}
 
+	if checkNotModified(c, pollListETag(page, limit, status, total, polls), time.Time{}, cacheControlActive) {
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"polls": polls,
 		"pagination": gin.H{
@@ -134,8 +314,10 @@ func (h *PollHandler) Vote(c *gin.Context) {
 		return
 	}
 
+	// Either option_index (position in the poll's options) or option_id is accepted
 	var vote struct {
-		OptionIndex int `json:"option_index" binding:"required"`
+		OptionIndex *int `json:"option_index"`
+		OptionID    uint `json:"option_id"`
 	}
 
 	if err := c.ShouldBindJSON(&vote); err != nil {
@@ -146,6 +328,13 @@ func (h *PollHandler) Vote(c *gin.Context) {
 		})
 		return
 	}
+	if vote.OptionIndex == nil && vote.OptionID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "error",
+			"error":  "option_index or option_id is required",
+		})
+		return
+	}
 
 	pollID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -156,65 +345,122 @@ func (h *PollHandler) Vote(c *gin.Context) {
 		return
 	}
 
-	// Check if poll exists and is active
-	poll, err := h.repo.GetPollByID(uint(pollID))
+	optionID := vote.OptionID
+	if optionID == 0 {
+		// Resolve the index to an option ID; the vote transaction re-checks everything
+		poll, err := h.polls(c).GetPollByID(uint(pollID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": "error",
+				"error":  "Poll not found",
+			})
+			return
+		}
+
+		if *vote.OptionIndex < 0 || *vote.OptionIndex >= len(poll.Options) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status": "error",
+				"error":  "Invalid option index",
+			})
+			return
+		}
+		optionID = poll.Options[*vote.OptionIndex].ID
+	}
+
+	// Look up the monthly vote quota; the vote transaction enforces it
+	since, quotaCheck, err := h.quotas.WithContext(c.Request.Context()).VoteCheck(userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status": "error",
-			"error":  "Poll not found",
+			"error":  "Failed to check quota",
 		})
 		return
 	}
 
-	if !poll.IsActive() {
+	// Record vote; poll state, option ownership and uniqueness are checked in one transaction
+	_, err = h.polls(c).CastVoteWithin(uint(pollID), optionID, userID, since, quotaCheck)
+	var exceeded *quota.ExceededError
+	switch {
+	case errors.As(err, &exceeded):
+		respondQuotaExceeded(c, exceeded)
+		return
+	case errors.Is(err, repository.ErrPollNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "error",
+			"error":  "Poll not found",
+		})
+		return
+	case errors.Is(err, repository.ErrPollClosed):
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status": "error",
 			"error":  "Poll has ended",
 		})
 		return
-	}
-
-	// Validate option index
-	if vote.OptionIndex < 0 || vote.OptionIndex >= len(poll.Options) {
+	case errors.Is(err, repository.ErrOptionNotInPoll):
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status": "error",
-			"error":  "Invalid option index",
+			"error":  "Invalid option for this poll",
+		})
+		return
+	case errors.Is(err, repository.ErrAlreadyVoted):
+		c.JSON(http.StatusConflict, gin.H{
+			"status": "error",
+			"error":  "You have already voted on this poll",
+		})
+		return
+	case err != nil:
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to record vote",
 		})
 		return
 	}
 
-	optionID := poll.Options[vote.OptionIndex].ID
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Vote recorded successfully",
+	})
+}
 
-	// Check if user has already voted
-	hasVoted, err := h.repo.HasUserVoted(uint(pollID), userID)
+// SetHighTraffic switches a poll between a single counter per option and sharded
+// counters that absorb bursts of concurrent votes
+func (h *PollHandler) SetHighTraffic(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status": "error",
-			"error":  "Failed to check voting status",
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 		return
 	}
-	if hasVoted {
-		c.JSON(http.StatusConflict, gin.H{
-			"status": "error",
-			"error":  "You have already voted on this poll",
+
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
 		})
 		return
 	}
 
-	// Record vote with user ID
-	err = h.repo.RecordVote(uint(pollID), optionID, userID)
+	err = h.polls(c).SetHighTraffic(uint(id), *req.Enabled)
+	if errors.Is(err, repository.ErrPollNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+		return
+	}
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"error":   "Failed to record vote",
-			"details": err.Error(),
+			"status": "error",
+			"error":  "Failed to update poll",
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
-		"message": "Vote recorded successfully",
+		"message": "Poll updated successfully",
 	})
 }
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pollingPlatform/models"
+	"pollingPlatform/quota"
+	"pollingPlatform/repository"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type QuotaHandler struct {
+	quotas *quota.Service
+	plans  *repository.PlanRepository
+	users  repository.UserStore
+}
+
+func NewQuotaHandler(quotas *quota.Service, plans *repository.PlanRepository, users repository.UserStore) *QuotaHandler {
+	return &QuotaHandler{quotas: quotas, plans: plans, users: users}
+}
+
+func (h *QuotaHandler) GetUsage(c *gin.Context) {
+	usage, err := h.quotas.WithContext(c.Request.Context()).Usage(c.GetUint("userID"))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+func (h *QuotaHandler) ListPlans(c *gin.Context) {
+	plans, err := h.plans.ListPlans()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"plans": plans})
+}
+
+type planRequest struct {
+	Description       string `json:"description" binding:"max=200"`
+	MaxActivePolls    int    `json:"maxActivePolls" binding:"min=0"`
+	MaxOptionsPerPoll int    `json:"maxOptionsPerPoll" binding:"min=0,max=10"`
+	MaxVotesPerMonth  int    `json:"maxVotesPerMonth" binding:"min=0"`
+}
+
+func (h *QuotaHandler) CreatePlan(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+		planRequest
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if !roleNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Validation failed",
+			"details": "plan name must be 2-30 lowercase letters, digits or dashes",
+		})
+		return
+	}
+	if _, err := h.plans.GetPlanByName(name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"status": "error",
+			"error":  "Plan already exists",
+		})
+		return
+	}
+
+	plan := models.Plan{
+		Name:              name,
+		Description:       strings.TrimSpace(req.Description),
+		MaxActivePolls:    req.MaxActivePolls,
+		MaxOptionsPerPoll: req.MaxOptionsPerPoll,
+		MaxVotesPerMonth:  req.MaxVotesPerMonth,
+	}
+	if err := h.plans.CreatePlan(&plan); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to create plan",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Plan created successfully",
+		"data":    plan,
+	})
+}
+
+func (h *QuotaHandler) UpdatePlan(c *gin.Context) {
+	var req planRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	plan, err := h.plans.GetPlanByName(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		return
+	}
+
+	plan.Description = strings.TrimSpace(req.Description)
+	plan.MaxActivePolls = req.MaxActivePolls
+	plan.MaxOptionsPerPoll = req.MaxOptionsPerPoll
+	plan.MaxVotesPerMonth = req.MaxVotesPerMonth
+	if err := h.plans.UpdatePlan(plan); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to update plan",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Plan updated successfully",
+		"data":    plan,
+	})
+}
+
+// AssignPlan changes a user's plan, failing rather than overwriting a change made since
+// the user was read. Clients may send If-Match with the version they looked at.
+func (h *QuotaHandler) AssignPlan(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req struct {
+		Plan string `json:"plan" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if _, err := h.plans.GetPlanByName(req.Plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "error",
+			"error":  "Unknown plan",
+		})
+		return
+	}
+
+	user, err := h.users.GetUserByID(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch != "" && !ifMatchSatisfied(ifMatch, user.Version) {
+		respondUserConflict(c, http.StatusPreconditionFailed, user)
+		return
+	}
+
+	err = h.users.UpdatePlan(user.ID, req.Plan, user.Version)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		respondUserChanged(c, h.users, ifMatch, user.ID)
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to assign plan",
+		})
+		return
+	}
+
+	user.Version++
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Plan assigned successfully",
+	})
+}
+
+// respondQuotaExceeded reports a quota error. Quotas are long-term limits, so this is
+// a 403 with a machine-readable code rather than a retryable 429.
+func respondQuotaExceeded(c *gin.Context, err *quota.ExceededError) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"status": "error",
+		"error":  "Plan quota exceeded",
+		"code":   "quota_exceeded",
+		"quota":  err.Quota,
+		"limit":  err.Limit,
+		"used":   err.Used,
+	})
+}
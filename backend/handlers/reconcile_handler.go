@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"pollingPlatform/reconcile"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReconcileHandler struct {
+	reconciler *reconcile.Reconciler
+}
+
+func NewReconcileHandler(reconciler *reconcile.Reconciler) *ReconcileHandler {
+	return &ReconcileHandler{reconciler: reconciler}
+}
+
+// GetReport returns the result of the last reconciliation run
+func (h *ReconcileHandler) GetReport(c *gin.Context) {
+	report := h.reconciler.Last()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reconciliation has not run yet"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report, "consistent": report.Consistent()})
+}
+
+// Run reconciles now. ?poll=<id> limits the check to one poll; ?repair=true fixes drifted counters.
+func (h *ReconcileHandler) Run(c *gin.Context) {
+	var pollID uint64
+	if p := c.Query("poll"); p != "" {
+		var err error
+		pollID, err = strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+			return
+		}
+	}
+	repair := c.Query("repair") == "true"
+
+	report, err := h.reconciler.Run(c.Request.Context(), uint(pollID), repair)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Reconciliation failed",
+			"report": report,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"report":     report,
+		"consistent": report.Consistent(),
+	})
+}
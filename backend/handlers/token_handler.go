@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"pollingPlatform/middleware"
+	"pollingPlatform/models"
+	"pollingPlatform/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxActiveTokens caps the number of usable personal access tokens per user
+const maxActiveTokens = 20
+
+type TokenHandler struct {
+	repo *repository.TokenRepository
+}
+
+func NewTokenHandler(repo *repository.TokenRepository) *TokenHandler {
+	return &TokenHandler{repo: repo}
+}
+
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var req struct {
+		Name          string   `json:"name" binding:"required,min=1,max=100"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	active, err := h.repo.CountActiveTokens(userID)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to create token",
+		})
+		return
+	}
+	if active >= maxActiveTokens {
+		c.JSON(http.StatusConflict, gin.H{
+			"status": "error",
+			"error":  "Maximum number of active tokens reached",
+		})
+		return
+	}
+
+	raw, prefix, hash, err := middleware.GeneratePersonalAccessToken()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to generate token",
+		})
+		return
+	}
+
+	token := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    prefix,
+		TokenHash: hash,
+		Scopes:    strings.Join(scopes, ","),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := h.repo.CreateToken(&token); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to create token",
+		})
+		return
+	}
+
+	// The raw token is only ever returned here
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"message": "Token created. Copy it now, it will not be shown again.",
+		"token":   raw,
+		"data":    tokenResponse(token),
+	})
+}
+
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.repo.ListTokensByUser(c.GetUint("userID"))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to fetch tokens",
+		})
+		return
+	}
+
+	data := make([]gin.H, 0, len(tokens))
+	for _, t := range tokens {
+		data = append(data, tokenResponse(t))
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": data})
+}
+
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	revoked, err := h.repo.RevokeToken(uint(id), c.GetUint("userID"))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "error",
+			"error":  "Failed to revoke token",
+		})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Token revoked",
+	})
+}
+
+func tokenResponse(t models.PersonalAccessToken) gin.H {
+	return gin.H{
+		"id":         t.ID,
+		"name":       t.Name,
+		"prefix":     t.Prefix,
+		"scopes":     t.ScopeList(),
+		"createdAt":  t.CreatedAt,
+		"expiresAt":  t.ExpiresAt,
+		"lastUsedAt": t.LastUsedAt,
+		"lastUsedIp": t.LastUsedIP,
+		"revoked":    t.RevokedAt != nil,
+	}
+}
+
+// normalizeScopes validates requested scopes and removes duplicates
+func normalizeScopes(requested []string) ([]string, error) {
+	valid := make(map[string]bool, len(models.ValidScopes))
+	for _, s := range models.ValidScopes {
+		valid[s] = true
+	}
+
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, s := range requested {
+		s = strings.TrimSpace(s)
+		if !valid[s] {
+			return nil, fmt.Errorf("invalid scope %q (allowed: %s)", s, strings.Join(models.ValidScopes, ", "))
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
@@ -0,0 +1,228 @@
+// Package health reports whether the service can take traffic. A Checker probes
+// the dependencies registered with it; background jobs report their runs through
+// RecordJob so a stuck worker shows up too.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status of one dependency. Degraded dependencies are reported but don't make the
+// service unready.
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded"
+	StatusFailing  Status = "failing"
+)
+
+// Overall readiness reported by Checker.Ready
+const (
+	Ready        = "ready"
+	NotReady     = "not_ready"
+	ShuttingDown = "shutting_down"
+)
+
+// Result is the outcome of one check. The public report only carries a generic
+// error; the cause is logged.
+type Result struct {
+	Status    Status  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of a readiness check
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// OK reports whether the service should receive traffic
+func (r *Report) OK() bool {
+	return r.Status == Ready
+}
+
+// check probes one dependency
+type check func(ctx context.Context) (Status, error)
+
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]check
+	// failures holds the latest error of each failing check, to log changes only
+	failures map[string]string
+
+	draining atomic.Bool
+}
+
+// NewChecker returns a checker that gives each readiness check up to timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: map[string]check{}, failures: map[string]string{}}
+}
+
+// Add registers a dependency; an error from probe makes the service unready
+func (c *Checker) Add(name string, probe func(ctx context.Context) error) {
+	c.add(name, func(ctx context.Context) (Status, error) {
+		if err := probe(ctx); err != nil {
+			return StatusFailing, err
+		}
+		return StatusOK, nil
+	})
+}
+
+// AddWorker registers a background job that runs every interval. The worker is
+// failing when no run has finished for three intervals and degraded while its
+// latest run failed.
+func (c *Checker) AddWorker(job string, interval time.Duration) {
+	registered := time.Now()
+	c.add("worker:"+job, func(context.Context) (Status, error) {
+		last, ran := lastRun(job)
+		since := registered
+		if ran && last.at.After(since) {
+			since = last.at
+		}
+		if idle := time.Since(since); idle > 3*interval {
+			return StatusFailing, fmt.Errorf("no run finished in %s", idle.Round(time.Second))
+		}
+		if ran && last.err != nil {
+			return StatusDegraded, last.err
+		}
+		return StatusOK, nil
+	})
+}
+
+func (c *Checker) add(name string, fn check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = fn
+}
+
+// Drain makes the service unready from now on so load balancers stop sending it
+// traffic before it shuts down
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs every check concurrently and combines the results
+func (c *Checker) Ready(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	c.mu.RLock()
+	checks := make(map[string]check, len(c.checks))
+	for name, fn := range c.checks {
+		checks[name] = fn
+	}
+	c.mu.RUnlock()
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	report := &Report{Status: Ready, Checks: make(map[string]Result, len(checks))}
+	for name, fn := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := run(ctx, fn)
+			c.logChange(name, result.Status, err)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status == StatusFailing {
+				report.Status = NotReady
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.draining.Load() {
+		report.Status = ShuttingDown
+	}
+	return report
+}
+
+// run times fn and returns its result along with the error behind it; a check that
+// outlives ctx is failing even if it ignores ctx
+func run(ctx context.Context, fn check) (Result, error) {
+	type outcome struct {
+		status Status
+		err    error
+	}
+	start := time.Now()
+	done := make(chan outcome, 1)
+	go func() {
+		status, err := fn(ctx)
+		done <- outcome{status, err}
+	}()
+
+	var o outcome
+	select {
+	case o = <-done:
+	case <-ctx.Done():
+		o = outcome{StatusFailing, ctx.Err()}
+	}
+	result := Result{Status: o.status, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	switch {
+	case errors.Is(o.err, context.DeadlineExceeded):
+		result.Error = "timed out"
+	case o.err != nil && o.status == StatusDegraded:
+		result.Error = "last run failed"
+	case o.err != nil:
+		result.Error = "unavailable"
+	}
+	return result, o.err
+}
+
+// logChange logs a check's error when it first fails or the error changes, and
+// when it recovers, so frequent probes don't flood the log
+func (c *Checker) logChange(name string, status Status, err error) {
+	c.mu.Lock()
+	previous, failed := c.failures[name]
+	if err != nil {
+		c.failures[name] = err.Error()
+	} else {
+		delete(c.failures, name)
+	}
+	c.mu.Unlock()
+
+	switch {
+	case err != nil && (!failed || previous != err.Error()):
+		slog.Warn("Readiness check failed", "check", name, "status", status, "error", err)
+	case err == nil && failed:
+		slog.Info("Readiness check recovered", "check", name)
+	}
+}
+
+// jobRun is the latest finished run of a background job
+type jobRun struct {
+	at  time.Time
+	err error
+}
+
+var jobs = struct {
+	sync.Mutex
+	runs map[string]jobRun
+}{runs: map[string]jobRun{}}
+
+// RecordJob records that a run of job just finished with err
+func RecordJob(job string, err error) {
+	jobs.Lock()
+	defer jobs.Unlock()
+	jobs.runs[job] = jobRun{at: time.Now(), err: err}
+}
+
+func lastRun(job string) (jobRun, bool) {
+	jobs.Lock()
+	defer jobs.Unlock()
+	run, ok := jobs.runs[job]
+	return run, ok
+}
@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReady(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("database", func(context.Context) error { return nil })
+	c.AddWorker("test_cleanup", time.Hour)
+
+	report := c.Ready(context.Background())
+	if !report.OK() || len(report.Checks) != 2 {
+		t.Fatalf("report %+v", report)
+	}
+
+	// A failed run degrades the worker without making the service unready
+	RecordJob("test_cleanup", errors.New("disk full"))
+	report = c.Ready(context.Background())
+	if got := report.Checks["worker:test_cleanup"]; got.Status != StatusDegraded || got.Error == "" || !report.OK() {
+		t.Fatalf("degraded worker: %+v", report)
+	}
+	RecordJob("test_cleanup", nil)
+
+	c.Add("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	report = c.Ready(context.Background())
+	if report.Status != NotReady || report.Checks["slow"].Status != StatusFailing {
+		t.Fatalf("slow check not failed: %+v", report)
+	}
+	if report.Checks["slow"].Error != "timed out" {
+		t.Fatalf("slow check error %q", report.Checks["slow"].Error)
+	}
+	if report.Checks["database"].Status != StatusOK {
+		t.Fatalf("healthy check affected by a slow one: %+v", report)
+	}
+}
+
+func TestStuckWorker(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.AddWorker("test_stuck", 10*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	report := c.Ready(context.Background())
+	if report.Status != NotReady || report.Checks["worker:test_stuck"].Status != StatusFailing {
+		t.Fatalf("stuck worker not failed: %+v", report)
+	}
+
+	RecordJob("test_stuck", nil)
+	if report := c.Ready(context.Background()); !report.OK() {
+		t.Fatalf("worker that just ran: %+v", report)
+	}
+}
+
+func TestErrorsNotExposed(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(context.Context) error {
+		return errors.New(`dial tcp 10.0.3.7:5432: password authentication failed for user "polls"`)
+	})
+	report := c.Ready(context.Background())
+	if got := report.Checks["database"]; got.Status != StatusFailing || got.Error != "unavailable" {
+		t.Fatalf("database check %+v", got)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Drain()
+	if report := c.Ready(context.Background()); report.Status != ShuttingDown || report.OK() {
+		t.Fatalf("draining checker reported %q", report.Status)
+	}
+}
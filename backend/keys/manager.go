@@ -0,0 +1,306 @@
+// Package keys manages the asymmetric keys used to sign and verify JWTs.
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pollingPlatform/health"
+	"pollingPlatform/metrics"
+	"pollingPlatform/models"
+	"pollingPlatform/repository"
+	"pollingPlatform/tracing"
+	"sync"
+	"time"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+type Config struct {
+	// Algorithm used for newly generated keys (RS256 or EdDSA)
+	Algorithm string
+	// RotationInterval is how long a key is used for signing before a new one takes over
+	RotationInterval time.Duration
+	// VerificationGrace keeps a key published after rotation so tokens it signed
+	// stay valid; it should be at least the refresh token lifetime
+	VerificationGrace time.Duration
+	// PublishDelay keeps a new key verification-only before it signs, so every
+	// instance has loaded it by then; it should exceed the reload interval
+	PublishDelay time.Duration
+	// Secret encrypts private keys at rest
+	Secret string
+}
+
+// Key is a loaded signing key
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	CreatedAt time.Time
+	RetiresAt time.Time
+}
+
+func (k *Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// missReloadInterval limits reloads for tokens with an unknown kid, which forged
+// tokens can send at will
+const missReloadInterval = 10 * time.Second
+
+// Manager holds the active keys. The newest published key signs; all unretired keys
+// verify. Keys live in the database so every instance shares them and restarts keep
+// sessions.
+type Manager struct {
+	repo *repository.SigningKeyRepository
+	cfg  Config
+
+	mu   sync.RWMutex
+	keys []*Key
+
+	// missMu serializes reloads for unknown kids; lastMiss is when the last one ran
+	missMu   sync.Mutex
+	lastMiss time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewManager(repo *repository.SigningKeyRepository, cfg Config) (*Manager, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("keys: a secret is required to encrypt signing keys")
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgorithmRS256
+	}
+	if cfg.Algorithm != AlgorithmRS256 && cfg.Algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("keys: unsupported algorithm %q", cfg.Algorithm)
+	}
+	if cfg.RotationInterval <= 0 {
+		cfg.RotationInterval = 24 * time.Hour
+	}
+	if cfg.VerificationGrace <= 0 {
+		cfg.VerificationGrace = 7 * 24 * time.Hour
+	}
+
+	m := &Manager{repo: repo, cfg: cfg}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	if err := m.rotateIfDue(m.repo); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SigningKey returns the key new tokens should be signed with: the newest key
+// published for at least PublishDelay, or the oldest key when none has been yet
+func (m *Manager) SigningKey() (*Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.keys) == 0 {
+		return nil, errors.New("keys: no signing key available")
+	}
+	for _, k := range m.keys {
+		if time.Since(k.CreatedAt) >= m.cfg.PublishDelay {
+			return k, nil
+		}
+	}
+	return m.keys[len(m.keys)-1], nil
+}
+
+// VerificationKey returns the unretired key with the given key ID. An unknown kid
+// may have been created by another instance since the last reload, so the keys are
+// reloaded, at most once per missReloadInterval.
+func (m *Manager) VerificationKey(kid string) (*Key, bool) {
+	if k, ok := m.lookup(kid); ok || kid == "" {
+		return k, ok
+	}
+
+	m.missMu.Lock()
+	defer m.missMu.Unlock()
+	// Another caller may have reloaded while this one waited
+	if k, ok := m.lookup(kid); ok || time.Since(m.lastMiss) < missReloadInterval {
+		return k, ok
+	}
+	m.lastMiss = time.Now()
+	if err := m.Reload(); err != nil {
+		slog.Warn("reloading signing keys for unknown kid failed", "kid", kid, "error", err)
+		return nil, false
+	}
+	return m.lookup(kid)
+}
+
+func (m *Manager) lookup(kid string) (*Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	for _, k := range m.keys {
+		if k.ID == kid && now.Before(k.RetiresAt) {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns all keys that are currently published for verification
+func (m *Manager) Keys() []*Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*Key(nil), m.keys...)
+}
+
+// Reload reads the active keys from the database, picking up rotations done by other instances
+func (m *Manager) Reload() error {
+	return m.reload(m.repo)
+}
+
+func (m *Manager) reload(repo *repository.SigningKeyRepository) error {
+	records, err := repo.ListActiveKeys()
+	if err != nil {
+		return fmt.Errorf("keys: loading signing keys: %w", err)
+	}
+
+	keys := make([]*Key, 0, len(records))
+	for _, rec := range records {
+		private, err := decryptPrivateKey(m.cfg.Secret, rec.PrivateKey)
+		if err != nil {
+			slog.Warn("skipping signing key", "kid", rec.KID, "error", err)
+			continue
+		}
+		keys = append(keys, &Key{
+			ID:        rec.KID,
+			Algorithm: rec.Algorithm,
+			Private:   private,
+			CreatedAt: rec.CreatedAt,
+			RetiresAt: rec.RetiresAt,
+		})
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.mu.Unlock()
+	return nil
+}
+
+// Rotate generates a new key. It verifies at once and signs after PublishDelay;
+// existing keys keep verifying until they retire.
+func (m *Manager) Rotate() error {
+	return m.rotate(m.repo)
+}
+
+func (m *Manager) rotate(repo *repository.SigningKeyRepository) error {
+	private, err := generatePrivateKey(m.cfg.Algorithm)
+	if err != nil {
+		return fmt.Errorf("keys: generating key: %w", err)
+	}
+	encrypted, err := encryptPrivateKey(m.cfg.Secret, private)
+	if err != nil {
+		return fmt.Errorf("keys: encrypting key: %w", err)
+	}
+
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return err
+	}
+
+	record := models.SigningKey{
+		KID:        hex.EncodeToString(kid),
+		Algorithm:  m.cfg.Algorithm,
+		PrivateKey: encrypted,
+		RetiresAt:  time.Now().Add(m.cfg.PublishDelay + m.cfg.RotationInterval + m.cfg.VerificationGrace),
+	}
+	if err := repo.CreateKey(&record); err != nil {
+		return fmt.Errorf("keys: storing key: %w", err)
+	}
+
+	slog.Info("rotated JWT signing key", "kid", record.KID, "alg", record.Algorithm)
+	return m.reload(repo)
+}
+
+// rotateIfDue rotates once the newest key, which may still be waiting to sign, is
+// RotationInterval old or uses another algorithm
+func (m *Manager) rotateIfDue(repo *repository.SigningKeyRepository) error {
+	m.mu.RLock()
+	var newest *Key
+	if len(m.keys) > 0 {
+		newest = m.keys[0]
+	}
+	m.mu.RUnlock()
+	if newest != nil && time.Since(newest.CreatedAt) < m.cfg.RotationInterval && newest.Algorithm == m.cfg.Algorithm {
+		return nil
+	}
+	return m.rotate(repo)
+}
+
+// Start checks periodically whether the signing key is due for rotation and
+// removes retired keys
+func (m *Manager) Start(interval time.Duration) {
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				start := time.Now()
+				err := tracing.RunJob("signing_keys", func(ctx context.Context) error {
+					return m.maintain(m.repo.WithContext(ctx))
+				})
+				metrics.RecordJob("signing_keys", start, err)
+				health.RecordJob("signing_keys", err)
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// maintain reloads the keys, rotates if due and deletes retired keys
+func (m *Manager) maintain(repo *repository.SigningKeyRepository) error {
+	if err := m.reload(repo); err != nil {
+		slog.Warn("reloading signing keys failed", "error", err)
+		return err
+	}
+	rotateErr := m.rotateIfDue(repo)
+	if rotateErr != nil {
+		slog.Warn("key rotation failed", "error", rotateErr)
+	}
+	deleteErr := repo.DeleteRetiredKeys()
+	if deleteErr != nil {
+		slog.Warn("deleting retired keys failed", "error", deleteErr)
+	}
+	return errors.Join(rotateErr, deleteErr)
+}
+
+func (m *Manager) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+}
+
+func generatePrivateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+}
@@ -0,0 +1,92 @@
+package keys
+
+import (
+	"pollingPlatform/models"
+	"pollingPlatform/repository"
+	"pollingPlatform/repository/storetest"
+	"testing"
+	"time"
+)
+
+func TestRotationAcrossInstances(t *testing.T) {
+	db := storetest.OpenSQLite(t)
+	cfg := Config{Algorithm: AlgorithmEdDSA, Secret: "test-secret", PublishDelay: time.Hour}
+	rotating, err := NewManager(repository.NewSigningKeyRepository(db), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewManager(repository.NewSigningKeyRepository(db), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := rotating.SigningKey()
+	if k, _ := other.SigningKey(); k.ID != first.ID {
+		t.Fatalf("instances sign with %s and %s", first.ID, k.ID)
+	}
+
+	if err := rotating.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	next := rotating.Keys()[0]
+	if next.ID == first.ID {
+		t.Fatal("rotation did not add a key")
+	}
+
+	// The new key verifies everywhere but doesn't sign until it has been published
+	// for PublishDelay
+	if k, _ := rotating.SigningKey(); k.ID != first.ID {
+		t.Fatalf("signing with %s before its publish delay", k.ID)
+	}
+	if _, ok := other.VerificationKey(next.ID); !ok {
+		t.Fatal("other instance rejects the new kid before its next reload")
+	}
+
+	if err := db.Model(&models.SigningKey{}).Where("kid = ?", next.ID).
+		Update("created_at", time.Now().Add(-cfg.PublishDelay)).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []*Manager{rotating, other} {
+		if err := m.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if k, _ := m.SigningKey(); k.ID != next.ID {
+			t.Fatalf("signing with %s after the publish delay, want %s", k.ID, next.ID)
+		}
+	}
+	if _, ok := other.VerificationKey(first.ID); !ok {
+		t.Fatal("previous key stopped verifying")
+	}
+}
+
+func TestUnknownKidReloadIsRateLimited(t *testing.T) {
+	db := storetest.OpenSQLite(t)
+	cfg := Config{Algorithm: AlgorithmEdDSA, Secret: "test-secret"}
+	m, err := NewManager(repository.NewSigningKeyRepository(db), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewManager(repository.NewSigningKeyRepository(db), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A bogus kid triggers a reload, so a key created right after stays unseen
+	// until the interval has passed
+	if _, ok := m.VerificationKey("forged"); ok {
+		t.Fatal("accepted an unknown kid")
+	}
+	if err := other.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	kid := other.Keys()[0].ID
+	if _, ok := m.VerificationKey(kid); ok {
+		t.Fatal("reloaded again within missReloadInterval")
+	}
+
+	m.missMu.Lock()
+	m.lastMiss = time.Now().Add(-missReloadInterval)
+	m.missMu.Unlock()
+	if _, ok := m.VerificationKey(kid); !ok {
+		t.Fatal("unknown kid not picked up once the interval passed")
+	}
+}
@@ -0,0 +1,423 @@
+// Package metrics is a small metrics registry that renders the Prometheus text
+// exposition format. Packages declare their metrics once, usually as package
+// variables on Default, and /metrics serves the registry.
+//
+// It stands in for prometheus/client_golang because the service only needs counters,
+// gauges and histograms in text format 0.0.4, which take a few hundred lines to
+// render. Switch to client_golang if that stops being true, e.g. for its Go runtime
+// collectors or for exemplars. metrics_test.go checks the output against the
+// format's escaping and histogram rules.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets suit request and job durations in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry served at /metrics
+var Default = NewRegistry()
+
+// Registry holds named metrics. Registering the same name twice panics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// metric is anything that can write its samples
+type metric interface {
+	write(w *bufio.Writer, name string)
+	help() string
+	kind() string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.metrics[name]; exists {
+		panic("metrics: " + name + " registered twice")
+	}
+	r.metrics[name] = m
+}
+
+// WriteTo renders every metric, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make(map[string]metric, len(r.metrics))
+	for name, m := range r.metrics {
+		metrics[name] = m
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		m := metrics[name]
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(m.help()))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, m.kind())
+		m.write(bw, name)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// Counter only goes up
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter; negative values are ignored
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Gauge can go up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Add(v float64) {
+	addFloat(&g.bits, v)
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	upper  []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	upper := append([]float64(nil), buckets...)
+	sort.Float64s(upper)
+	return &Histogram{upper: upper, counts: make([]atomic.Uint64, len(upper))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	if i := sort.SearchFloat64s(h.upper, v); i < len(h.upper) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	addFloat(&h.sum, v)
+}
+
+// ObserveSince records the seconds elapsed since start
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) writeSamples(w *bufio.Writer, name, labels string) {
+	var cumulative uint64
+	for i, upper := range h.upper {
+		cumulative += h.counts[i].Load()
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(upper)), cumulative)
+	}
+	count := h.count.Load()
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(math.Float64frombits(h.sum.Load())))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, count)
+}
+
+// NewCounter registers a counter without labels
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, &single{helpText: help, kindName: "counter", value: c.Value})
+	return c
+}
+
+// NewGauge registers a gauge without labels
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, &single{helpText: help, kindName: "gauge", value: g.Value})
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn at scrape time
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &single{helpText: help, kindName: "gauge", value: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn at scrape time
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &single{helpText: help, kindName: "counter", value: fn})
+}
+
+// NewHistogram registers a histogram without labels
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := newHistogram(buckets)
+	r.register(name, &histogramMetric{helpText: help, h: h})
+	return h
+}
+
+// single is a metric with one unlabelled sample
+type single struct {
+	helpText string
+	kindName string
+	value    func() float64
+}
+
+func (s *single) help() string { return s.helpText }
+func (s *single) kind() string { return s.kindName }
+func (s *single) write(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(s.value()))
+}
+
+type histogramMetric struct {
+	helpText string
+	h        *Histogram
+}
+
+func (m *histogramMetric) help() string { return m.helpText }
+func (m *histogramMetric) kind() string { return "histogram" }
+func (m *histogramMetric) write(w *bufio.Writer, name string) {
+	m.h.writeSamples(w, name, "")
+}
+
+// vec holds one child per combination of label values
+type vec[T any] struct {
+	helpText string
+	kindName string
+	labels   []string
+	newChild func() *T
+	writeOne func(w *bufio.Writer, name, labels string, child *T)
+
+	mu       sync.RWMutex
+	children map[string]*T
+}
+
+func (v *vec[T]) withLabelValues(values ...string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.labels)))
+	}
+	key := formatLabels(v.labels, values)
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+	child = v.newChild()
+	v.children[key] = child
+	return child
+}
+
+func (v *vec[T]) help() string { return v.helpText }
+func (v *vec[T]) kind() string { return v.kindName }
+func (v *vec[T]) write(w *bufio.Writer, name string) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	children := make([]*T, len(keys))
+	for i, key := range keys {
+		children[i] = v.children[key]
+	}
+	v.mu.RUnlock()
+
+	for i, key := range keys {
+		v.writeOne(w, name, key, children[i])
+	}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	v *vec[Counter]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &vec[Counter]{
+		helpText: help,
+		kindName: "counter",
+		labels:   labels,
+		newChild: func() *Counter { return &Counter{} },
+		writeOne: func(w *bufio.Writer, name, labels string, c *Counter) {
+			fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(c.Value()))
+		},
+		children: map[string]*Counter{},
+	}
+	r.register(name, v)
+	return &CounterVec{v: v}
+}
+
+// WithLabelValues returns the counter for the label values, in declaration order
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+	return c.v.withLabelValues(values...)
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	v *vec[Gauge]
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &vec[Gauge]{
+		helpText: help,
+		kindName: "gauge",
+		labels:   labels,
+		newChild: func() *Gauge { return &Gauge{} },
+		writeOne: func(w *bufio.Writer, name, labels string, g *Gauge) {
+			fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(g.Value()))
+		},
+		children: map[string]*Gauge{},
+	}
+	r.register(name, v)
+	return &GaugeVec{v: v}
+}
+
+func (g *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return g.v.withLabelValues(values...)
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	v *vec[Histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &vec[Histogram]{
+		helpText: help,
+		kindName: "histogram",
+		labels:   labels,
+		newChild: func() *Histogram { return newHistogram(buckets) },
+		writeOne: func(w *bufio.Writer, name, labels string, h *Histogram) {
+			h.writeSamples(w, name, labels)
+		},
+		children: map[string]*Histogram{},
+	}
+	r.register(name, v)
+	return &HistogramVec{v: v}
+}
+
+func (h *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return h.v.withLabelValues(values...)
+}
+
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// formatLabels renders {a="1",b="2"}; it doubles as the child key so series sort
+// by their labels
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLabel adds one label to an already formatted label set
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"math"
+	"pollingPlatform/cache"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests.\nBy route.", "route", "status")
+	requests.WithLabelValues("/b", "200").Add(2)
+	requests.WithLabelValues("/a", "500").Inc()
+	requests.WithLabelValues(`/q"\`, "200").Inc()
+
+	inFlight := r.NewGauge("in_flight", "In flight.")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		latency.WithLabelValues("/a").Observe(v)
+	}
+
+	r.NewGaugeFunc("answer", "The answer.", func() float64 { return 42 })
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP answer The answer.
+# TYPE answer gauge
+answer 42
+# HELP in_flight In flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 3
+latency_seconds_bucket{route="/a",le="+Inf"} 4
+latency_seconds_sum{route="/a"} 3.65
+latency_seconds_count{route="/a"} 4
+# HELP requests_total Requests.\nBy route.
+# TYPE requests_total counter
+requests_total{route="/a",status="500"} 1
+requests_total{route="/b",status="200"} 2
+requests_total{route="/q\"\\",status="200"} 1
+`
+	if out.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestDuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("jobs_total", "Jobs.")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a name twice did not panic")
+		}
+	}()
+	r.NewGauge("jobs_total", "Jobs.")
+}
+
+func TestCounterIgnoresDecrease(t *testing.T) {
+	c := NewRegistry().NewCounter("c", "C.")
+	c.Add(1.5)
+	c.Add(-1)
+	if c.Value() != 1.5 {
+		t.Fatalf("counter is %v", c.Value())
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("escaped_total", `Help with a \ backslash, "quotes"`+"\nand a newline.", "value").
+		WithLabelValues(`C:\dir "quoted"` + "\nnext").Inc()
+
+	got := scrape(t, r)
+	// Help text escapes backslashes and newlines only; label values also escape quotes
+	want := `# HELP escaped_total Help with a \\ backslash, "quotes"\nand a newline.
+# TYPE escaped_total counter
+escaped_total{value="C:\\dir \"quoted\"\nnext"} 1
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramOutput(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("size_bytes", "Size.", []float64{100, 10, 1000})
+	// Upper bounds are inclusive, and values above the last bucket only count in +Inf
+	for _, v := range []float64{10, 10.5, 100, 5000} {
+		h.Observe(v)
+	}
+	r.NewHistogram("empty_seconds", "Empty.", []float64{1})
+
+	got := scrape(t, r)
+	want := `# HELP empty_seconds Empty.
+# TYPE empty_seconds histogram
+empty_seconds_bucket{le="1"} 0
+empty_seconds_bucket{le="+Inf"} 0
+empty_seconds_sum 0
+empty_seconds_count 0
+# HELP size_bytes Size.
+# TYPE size_bytes histogram
+size_bytes_bucket{le="10"} 1
+size_bytes_bucket{le="100"} 3
+size_bytes_bucket{le="1000"} 3
+size_bytes_bucket{le="+Inf"} 4
+size_bytes_sum 5120.5
+size_bytes_count 4
+`
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSpecialValues(t *testing.T) {
+	r := NewRegistry()
+	values := map[string]float64{
+		"pos_inf": math.Inf(1),
+		"neg_inf": math.Inf(-1),
+		"nan":     math.NaN(),
+		"tiny":    1e-9,
+		"huge":    1e21,
+	}
+	for name, v := range values {
+		r.NewGaugeFunc(name, "Value.", func() float64 { return v })
+	}
+	r.NewHistogram("fractional", "Fractional bounds.", []float64{0.005, 2.5})
+
+	got := scrape(t, r)
+	for _, line := range []string{"pos_inf +Inf", "neg_inf -Inf", "nan NaN", "tiny 1e-09", "huge 1e+21",
+		`fractional_bucket{le="0.005"} 0`, `fractional_bucket{le="2.5"} 0`} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("output lacks %q:\n%s", line, got)
+		}
+	}
+}
+
+// Line grammar of the text exposition format, for the names and labels this
+// registry produces
+var (
+	helpLine   = regexp.MustCompile(`^# HELP ([a-zA-Z_:][a-zA-Z0-9_:]*) ((?:[^\\\n]|\\[\\n])*)$`)
+	typeLine   = regexp.MustCompile(`^# TYPE ([a-zA-Z_:][a-zA-Z0-9_:]*) (counter|gauge|histogram|summary|untyped)$`)
+	sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{(?:[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\["\\n])*",?)*\})? (\S+)$`)
+)
+
+// TestExpositionGrammar checks that every line of a scrape parses, that each family
+// has one HELP and TYPE ahead of its samples, and that histogram series are complete
+func TestExpositionGrammar(t *testing.T) {
+	r := NewRegistry()
+	odd := r.NewCounterVec("odd_labels_total", "Odd \\ help\nover lines.", "a", "b")
+	odd.WithLabelValues("", `}{,="`).Inc()
+	odd.WithLabelValues("\n\\", "ünïcode").Add(0.5)
+	r.NewGaugeVec("temperature", "Temperature.", "room").WithLabelValues("lab").Set(-273.15)
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", DefaultBuckets, "route")
+	latency.WithLabelValues(`/polls/"x"`).Observe(0.3)
+	latency.WithLabelValues("/a").Observe(42)
+	RegisterCacheStats(r, "poll", func() cache.Stats { return cache.Stats{Hits: 3, Size: 1, Capacity: 10} })
+
+	families := map[string]string{}
+	helped := map[string]bool{}
+	buckets := map[string]int{}
+	for i, line := range strings.Split(strings.TrimSuffix(scrape(t, r), "\n"), "\n") {
+		if m := helpLine.FindStringSubmatch(line); m != nil {
+			if helped[m[1]] {
+				t.Errorf("line %d: second HELP for %s", i+1, m[1])
+			}
+			helped[m[1]] = true
+			continue
+		}
+		if m := typeLine.FindStringSubmatch(line); m != nil {
+			if _, ok := families[m[1]]; ok || !helped[m[1]] {
+				t.Errorf("line %d: TYPE for %s repeated or without HELP", i+1, m[1])
+			}
+			families[m[1]] = m[2]
+			continue
+		}
+		m := sampleLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("line %d does not parse: %q", i+1, line)
+			continue
+		}
+		if _, err := strconv.ParseFloat(m[3], 64); err != nil {
+			t.Errorf("line %d: value %q: %v", i+1, m[3], err)
+		}
+		family := m[1]
+		if kind, ok := families[family]; !ok || kind == "histogram" {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if base := strings.TrimSuffix(family, suffix); base != family && families[base] == "histogram" {
+					family = base
+					if suffix == "_bucket" {
+						buckets[base+strings.Split(m[2], `le=`)[0]]++
+					}
+				}
+			}
+		}
+		if _, ok := families[family]; !ok {
+			t.Errorf("line %d: sample of %s before its TYPE", i+1, m[1])
+		}
+	}
+
+	// Each histogram series has every configured bucket plus +Inf
+	for series, n := range buckets {
+		if n != len(DefaultBuckets)+1 {
+			t.Errorf("%s has %d buckets, want %d", series, n, len(DefaultBuckets)+1)
+		}
+	}
+	if len(buckets) != 2 {
+		t.Errorf("got bucket series %v, want two", buckets)
+	}
+}
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
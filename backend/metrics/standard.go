@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"database/sql"
+	"pollingPlatform/cache"
+	"time"
+)
+
+var (
+	jobRuns = Default.NewCounterVec("background_job_runs_total",
+		"Background job runs by outcome (success or failure).", "job", "outcome")
+	jobDuration = Default.NewHistogramVec("background_job_duration_seconds",
+		"Background job run time.", DefaultBuckets, "job")
+)
+
+// RecordJob records one run of a background job that started at start
+func RecordJob(job string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	jobRuns.WithLabelValues(job, outcome).Inc()
+	jobDuration.WithLabelValues(job).ObserveSince(start)
+}
+
+// RegisterDBStats publishes the connection pool statistics of db on r
+func RegisterDBStats(r *Registry, db *sql.DB) {
+	r.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	r.NewGaugeFunc("db_open_connections", "Established connections, in use and idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	r.NewGaugeFunc("db_in_use_connections", "Connections currently in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	r.NewGaugeFunc("db_idle_connections", "Idle connections.",
+		func() float64 { return float64(db.Stats().Idle) })
+	r.NewCounterFunc("db_wait_count_total", "Connections waited for because the pool was exhausted.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	r.NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for a connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+	r.NewCounterFunc("db_max_idle_closed_total", "Connections closed because the idle pool was full.",
+		func() float64 { return float64(db.Stats().MaxIdleClosed) })
+	r.NewCounterFunc("db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+		func() float64 { return float64(db.Stats().MaxLifetimeClosed) })
+}
+
+// RegisterCacheStats publishes the statistics of a cache as <name>_cache_* metrics on r
+func RegisterCacheStats(r *Registry, name string, stats func() cache.Stats) {
+	r.NewCounterFunc(name+"_cache_hits_total", "Lookups answered from the "+name+" cache.",
+		func() float64 { return float64(stats().Hits) })
+	r.NewCounterFunc(name+"_cache_misses_total", "Lookups the "+name+" cache had to load.",
+		func() float64 { return float64(stats().Misses) })
+	r.NewCounterFunc(name+"_cache_evictions_total", "Entries evicted from the full "+name+" cache.",
+		func() float64 { return float64(stats().Evictions) })
+	r.NewGaugeFunc(name+"_cache_entries", "Entries held by the "+name+" cache.",
+		func() float64 { return float64(stats().Size) })
+	r.NewGaugeFunc(name+"_cache_capacity", "Maximum number of entries in the "+name+" cache.",
+		func() float64 { return float64(stats().Capacity) })
+}
@@ -3,7 +3,8 @@ package middleware
 import (
 	"errors"
 	"net/http"
-	"os"
+	"pollingPlatform/keys"
+	"pollingPlatform/repository"
 	"strings"
 	"time"
 
@@ -11,9 +12,17 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token types, carried in the typ claim so a refresh token can't be used as an
+// access token or the other way round
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 type Claims struct {
 	UserID uint   `json:"user_id"`
 	Role   string `json:"role"`
+	Type   string `json:"typ"`
 	jwt.RegisteredClaims
 }
 
@@ -34,13 +43,8 @@ func (c *Claims) Valid() error {
 		return errors.New("invalid user ID")
 	}
 
-	// Validate Role
-	role := strings.ToLower(c.Role)
-	validRoles := map[string]bool{
-		"user":  true,
-		"admin": true,
-	}
-	if !validRoles[role] {
+	// Validate Role (permissions are resolved from the role at authorization time)
+	if strings.TrimSpace(c.Role) == "" {
 		return errors.New("invalid role")
 	}
 
@@ -74,7 +78,24 @@ func (c *Claims) Valid() error {
 	return nil
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// JWTService signs tokens with the current asymmetric key and verifies them by kid
+type JWTService struct {
+	keys   *keys.Manager
+	issuer string
+	// legacySecret, when set, still accepts HS256 tokens issued before key rotation was introduced
+	legacySecret []byte
+}
+
+func NewJWTService(km *keys.Manager, issuer, legacySecret string) *JWTService {
+	s := &JWTService{keys: km, issuer: issuer}
+	if legacySecret != "" {
+		s.legacySecret = []byte(legacySecret)
+	}
+	return s
+}
+
+// AuthMiddleware accepts either a JWT access token or a personal access token as Bearer credentials
+func AuthMiddleware(jwtService *JWTService, tokenRepo *repository.TokenRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -82,50 +103,97 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		claims := &Claims{}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		if IsPersonalAccessToken(tokenString) {
+			authenticatePersonalAccessToken(c, tokenRepo, tokenString)
+			return
+		}
 
-		if err != nil || !token.Valid {
+		claims, err := jwtService.ParseToken(tokenString, TokenTypeAccess)
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			return
 		}
 		c.Set("userID", claims.UserID)
 		c.Set("userRole", claims.Role)
+		c.Set("authMethod", AuthMethodJWT)
 		c.Next()
 	}
 }
 
-func GenerateTokens(userID uint, role string) (string, string, error) {
-	// Access token
-	accessClaims := Claims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-		},
+// ParseToken verifies a token's signature against the key named in its kid header
+// and that it is of type typ. Legacy HS256 tokens predate the typ claim; they are only
+// accepted as refresh tokens so old sessions can still renew.
+func (s *JWTService) ParseToken(tokenString, typ string) (*Claims, error) {
+	methods := []string{keys.AlgorithmRS256, keys.AlgorithmEdDSA}
+	if s.legacySecret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if s.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.issuer))
 	}
 
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+			return s.legacySecret, nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys.VerificationKey(kid)
+		if !ok || key.Algorithm != token.Method.Alg() {
+			return nil, errors.New("unknown signing key")
+		}
+		return key.Public(), nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	legacy := token.Method.Alg() == jwt.SigningMethodHS256.Alg() && claims.Type == ""
+	if claims.Type != typ && !(legacy && typ == TokenTypeRefresh) {
+		return nil, errors.New("wrong token type")
+	}
+	return claims, nil
+}
+
+func (s *JWTService) GenerateTokens(userID uint, role string) (string, string, error) {
+	key, err := s.keys.SigningKey()
 	if err != nil {
 		return "", "", err
 	}
 
-	// Refresh token
-	refreshClaims := Claims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-		},
+	// Access token
+	accessToken, err := s.sign(key, userID, role, TokenTypeAccess, 15*time.Minute)
+	if err != nil {
+		return "", "", err
 	}
 
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	// Refresh token
+	refreshToken, err := s.sign(key, userID, role, TokenTypeRefresh, 7*24*time.Hour)
 	if err != nil {
 		return "", "", err
 	}
 
 	return accessToken, refreshToken, nil
 }
+
+func (s *JWTService) sign(key *keys.Key, userID uint, role, typ string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID: userID,
+		Role:   role,
+		Type:   typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"pollingPlatform/health"
+	"pollingPlatform/logging"
+	"pollingPlatform/metrics"
+	"pollingPlatform/models"
+	"pollingPlatform/repository"
+	"pollingPlatform/tracing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+// pendingLease is how long a reservation without a response holds its key unless
+// renewed. The request holding it renews it every third of the lease for as long as
+// its handler runs, so only a reservation left by a process that died expires.
+const pendingLease = time.Minute
+
+// Idempotency replays the stored response when a client retries a mutating request
+// with the same Idempotency-Key, so timeouts don't create duplicate polls or votes
+type Idempotency struct {
+	repo  *repository.IdempotencyRepository
+	ttl   time.Duration
+	lease time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewIdempotency(repo *repository.IdempotencyRepository, ttl time.Duration) *Idempotency {
+	return &Idempotency{repo: repo, ttl: ttl, lease: pendingLease}
+}
+
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Middleware must run after authentication; keys are scoped per user
+func (i *Idempotency) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status": "error",
+				"error":  "Idempotency-Key must be at most 255 characters",
+			})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"status": "error",
+				"error":  "Request body too large",
+			})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status": "error",
+				"error":  "Failed to read request body",
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &models.IdempotencyRecord{
+			UserID:      c.GetUint("userID"),
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: requestHash(c.Request.Method, c.Request.URL.Path, body),
+			ExpiresAt:   time.Now().Add(i.ttl),
+		}
+
+		existing, reserved, err := i.repo.Reserve(record, i.lease)
+		if err != nil {
+			c.Error(err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"status": "error",
+				"error":  "Failed to process Idempotency-Key",
+			})
+			return
+		}
+
+		if !reserved {
+			replay(c, existing, record.RequestHash)
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		stopRenewing := i.renew(c.Request.Context(), record.ID)
+		completed := false
+		defer func() {
+			if !completed {
+				stopRenewing()
+				// The handler panicked; free the key so the client can retry
+				if err := i.repo.Release(record.ID); err != nil {
+					logging.FromContext(c.Request.Context()).Warn("releasing idempotency key failed", "error", err)
+				}
+			}
+		}()
+
+		c.Next()
+		completed = true
+		stopRenewing()
+
+		status := writer.Status()
+		// Server errors and throttling are transient, so those aren't remembered
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			if err := i.repo.Release(record.ID); err != nil {
+				logging.FromContext(c.Request.Context()).Warn("releasing idempotency key failed", "error", err)
+			}
+			return
+		}
+		if err := i.repo.Complete(record.ID, status, writer.Header().Get("Content-Type"), writer.body.Bytes()); err != nil {
+			logging.FromContext(c.Request.Context()).Warn("storing idempotent response failed", "error", err)
+		}
+	}
+}
+
+// renew keeps the reservation id from expiring until the returned function is called
+func (i *Idempotency) renew(ctx context.Context, id uint) (stop func()) {
+	// Renewals outlive a cancelled request; the handler may still be writing
+	repo := i.repo.WithContext(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(i.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := repo.Renew(id); err != nil {
+					logging.FromContext(ctx).Warn("renewing idempotency key failed", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func replay(c *gin.Context, existing *models.IdempotencyRecord, hash string) {
+	if existing.RequestHash != hash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"status": "error",
+			"error":  "Idempotency-Key was already used with a different request",
+		})
+		return
+	}
+	if existing.StatusCode == 0 {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"status": "error",
+			"error":  "A request with this Idempotency-Key is still being processed",
+		})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(existing.StatusCode, existing.ContentType, existing.ResponseBody)
+	c.Abort()
+}
+
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Start deletes expired records in the background
+func (i *Idempotency) Start(interval time.Duration) {
+	i.stop = make(chan struct{})
+	i.done = make(chan struct{})
+	go func() {
+		defer close(i.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				start := time.Now()
+				err := tracing.RunJob("idempotency_cleanup", func(ctx context.Context) error {
+					return i.repo.WithContext(ctx).DeleteExpired()
+				})
+				metrics.RecordJob("idempotency_cleanup", start, err)
+				health.RecordJob("idempotency_cleanup", err)
+				if err != nil {
+					slog.Warn("deleting expired idempotency keys failed", "error", err)
+				}
+			case <-i.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (i *Idempotency) Stop() {
+	if i.stop == nil {
+		return
+	}
+	close(i.stop)
+	<-i.done
+	i.stop = nil
+}
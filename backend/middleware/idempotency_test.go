@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pollingPlatform/repository"
+	"pollingPlatform/repository/storetest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencySlowRequestKeepsKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	idempotency := NewIdempotency(repository.NewIdempotencyRepository(storetest.OpenSQLite(t)), time.Hour)
+	idempotency.lease = 150 * time.Millisecond
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	r := gin.New()
+	r.POST("/slow", func(c *gin.Context) { c.Set("userID", uint(1)) }, idempotency.Middleware(), func(c *gin.Context) {
+		// Only the first run waits, so a takeover shows up as a second run
+		if runs.Add(1) == 1 {
+			<-release
+		}
+		c.JSON(http.StatusCreated, gin.H{"created": true})
+	})
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/slow", strings.NewReader(`{}`))
+		req.Header.Set(idempotencyHeader, "slow")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- post() }()
+
+	// The handler outlives its lease several times over; the key stays reserved
+	time.Sleep(4 * idempotency.lease)
+	retry := post()
+	close(release)
+	if retry.Code != http.StatusConflict {
+		t.Fatalf("retry during the slow request: status %d, want %d", retry.Code, http.StatusConflict)
+	}
+	if w := <-first; w.Code != http.StatusCreated {
+		t.Fatalf("slow request: status %d", w.Code)
+	}
+
+	if w := post(); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry after completion: status %d, replayed %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("handler ran %d times", n)
+	}
+}
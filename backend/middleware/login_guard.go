@@ -0,0 +1,348 @@
+package middleware
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LoginGuardConfig struct {
+	// FreeAttempts is the number of failures tolerated before delays kick in
+	FreeAttempts int
+	// BaseDelay doubles with every failure past FreeAttempts, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// AccountLockoutThreshold failures on one account lock it for LockoutDuration
+	AccountLockoutThreshold int
+	// IPLockoutThreshold failures from one IP (across accounts) lock the IP
+	IPLockoutThreshold int
+	LockoutDuration    time.Duration
+	// Window after the last failure when the failure count is forgotten
+	Window time.Duration
+}
+
+func DefaultLoginGuardConfig() LoginGuardConfig {
+	return LoginGuardConfig{
+		FreeAttempts:            3,
+		BaseDelay:               time.Second,
+		MaxDelay:                time.Minute,
+		AccountLockoutThreshold: 10,
+		IPLockoutThreshold:      50,
+		LockoutDuration:         15 * time.Minute,
+		Window:                  time.Hour,
+	}
+}
+
+// Kinds of subjects tracked by the login guard
+const (
+	LockoutKindAccount = "account"
+	LockoutKindIP      = "ip"
+)
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	nextAllowed time.Time
+	lockedUntil time.Time
+}
+
+// LockoutStatus describes a tracked account or IP for the admin API
+type LockoutStatus struct {
+	Kind        string    `json:"kind"`
+	Subject     string    `json:"subject"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	Locked      bool      `json:"locked"`
+	LockedUntil time.Time `json:"lockedUntil,omitempty"`
+	NextAllowed time.Time `json:"nextAllowed,omitempty"`
+}
+
+// LoginGuard tracks failed logins per IP and per account and enforces
+// progressive delays followed by a temporary lockout
+type LoginGuard struct {
+	mu       sync.Mutex
+	cfg      LoginGuardConfig
+	accounts map[string]*loginAttempts
+	ips      map[string]*loginAttempts
+	notifier LoginNotifier
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewLoginGuard(cfg LoginGuardConfig, notifier LoginNotifier) *LoginGuard {
+	if notifier == nil {
+		notifier = LogNotifier{}
+	}
+	return &LoginGuard{
+		cfg:      cfg,
+		accounts: make(map[string]*loginAttempts),
+		ips:      make(map[string]*loginAttempts),
+		notifier: notifier,
+	}
+}
+
+// LoginAttempt is a login that Begin let through. It already counts as a failure;
+// the caller reports the outcome with Failed, Succeeded or Release.
+type LoginAttempt struct {
+	g           *LoginGuard
+	ip, account string
+	// the state of the IP and the account around this attempt's failure, so it can be
+	// taken back
+	ipCount, accountCount counted
+	accountLocked         bool
+	ipLocked              bool
+	now                   time.Time
+}
+
+// counted is a subject's state before and after Begin counted an attempt
+type counted struct {
+	tracked       bool
+	before, after loginAttempts
+}
+
+// Begin checks whether ip may try to log in to account now and, if so, counts the
+// attempt as a failure in the same step, so parallel guesses can't all pass the check
+// before any of them is recorded. Otherwise it returns how long the caller must wait
+// and whether that is because of a lockout rather than a progressive delay.
+func (g *LoginGuard) Begin(ip, account string) (*LoginAttempt, time.Duration, bool) {
+	account = normalizeAccount(account)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	locked := false
+	for _, a := range []*loginAttempts{g.ips[ip], g.accounts[account]} {
+		if a == nil {
+			continue
+		}
+		if now.Before(a.lockedUntil) {
+			locked = true
+			if d := a.lockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		} else if d := a.nextAllowed.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return nil, wait, locked
+	}
+
+	attempt := &LoginAttempt{g: g, ip: ip, account: account, now: now}
+	if a, ok := g.accounts[account]; ok {
+		attempt.accountCount = counted{tracked: true, before: *a}
+	}
+	if a, ok := g.ips[ip]; ok {
+		attempt.ipCount = counted{tracked: true, before: *a}
+	}
+	attempt.accountLocked = g.fail(g.accounts, account, g.cfg.AccountLockoutThreshold, now)
+	attempt.ipLocked = g.fail(g.ips, ip, g.cfg.IPLockoutThreshold, now)
+	attempt.accountCount.after = *g.accounts[account]
+	attempt.ipCount.after = *g.ips[ip]
+	return attempt, 0, false
+}
+
+// Failed confirms the attempt as a failed login and reports any lockout it caused
+func (a *LoginAttempt) Failed() {
+	g := a.g
+	g.mu.Lock()
+	var accountFailures, ipFailures int
+	if state, ok := g.accounts[a.account]; ok {
+		accountFailures = state.failures
+	}
+	if state, ok := g.ips[a.ip]; ok {
+		ipFailures = state.failures
+	}
+	g.mu.Unlock()
+
+	if a.accountLocked {
+		g.notifier.NotifySuspiciousLogin(SuspiciousLoginEvent{
+			Reason:   "account locked after repeated failed logins",
+			Account:  a.account,
+			IP:       a.ip,
+			Failures: accountFailures,
+			Time:     a.now,
+		})
+	}
+	if a.ipLocked {
+		g.notifier.NotifySuspiciousLogin(SuspiciousLoginEvent{
+			Reason:   "IP locked after repeated failed logins",
+			Account:  a.account,
+			IP:       a.ip,
+			Failures: ipFailures,
+			Time:     a.now,
+		})
+	}
+}
+
+// Succeeded clears the account's failures and takes back the failure counted for
+// the IP. Earlier IP failures are kept so an attacker cannot reset them by logging
+// into an account of their own.
+func (a *LoginAttempt) Succeeded() {
+	g := a.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.accounts, a.account)
+	uncount(g.ips, a.ip, a.ipCount)
+}
+
+// Release takes back the failure counted for an attempt whose credentials could not
+// be checked, e.g. because the database is down, so an outage doesn't delay or lock
+// out anyone
+func (a *LoginAttempt) Release() {
+	g := a.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	uncount(g.accounts, a.account, a.accountCount)
+	uncount(g.ips, a.ip, a.ipCount)
+}
+
+// uncount restores key's state from before an attempt was counted
+func uncount(m map[string]*loginAttempts, key string, c counted) {
+	state, ok := m[key]
+	switch {
+	case !ok:
+	case *state == c.after && !c.tracked:
+		delete(m, key)
+	case *state == c.after:
+		*state = c.before
+	case state.failures > 0:
+		// Other attempts were counted since; only drop this one
+		state.failures--
+	}
+}
+
+func (g *LoginGuard) fail(m map[string]*loginAttempts, key string, threshold int, now time.Time) bool {
+	a, ok := m[key]
+	if !ok || now.Sub(a.lastFailure) > g.cfg.Window {
+		a = &loginAttempts{}
+		m[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+
+	if extra := a.failures - g.cfg.FreeAttempts; extra > 0 {
+		delay := g.cfg.BaseDelay
+		for i := 1; i < extra && delay < g.cfg.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > g.cfg.MaxDelay {
+			delay = g.cfg.MaxDelay
+		}
+		a.nextAllowed = now.Add(delay)
+	}
+
+	if threshold > 0 && a.failures >= threshold && !now.Before(a.lockedUntil) {
+		a.lockedUntil = now.Add(g.cfg.LockoutDuration)
+		return true
+	}
+	return false
+}
+
+// Lockouts lists every account and IP with recent failures
+func (g *LoginGuard) Lockouts() []LockoutStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var statuses []LockoutStatus
+	collect := func(kind string, m map[string]*loginAttempts) {
+		for subject, a := range m {
+			s := LockoutStatus{
+				Kind:        kind,
+				Subject:     subject,
+				Failures:    a.failures,
+				LastFailure: a.lastFailure,
+				Locked:      now.Before(a.lockedUntil),
+			}
+			if s.Locked {
+				s.LockedUntil = a.lockedUntil
+			}
+			if now.Before(a.nextAllowed) {
+				s.NextAllowed = a.nextAllowed
+			}
+			statuses = append(statuses, s)
+		}
+	}
+	collect(LockoutKindAccount, g.accounts)
+	collect(LockoutKindIP, g.ips)
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].LastFailure.After(statuses[j].LastFailure)
+	})
+	return statuses
+}
+
+// Clear forgets the failures of an account or IP; it reports whether anything was tracked
+func (g *LoginGuard) Clear(kind, subject string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var m map[string]*loginAttempts
+	switch kind {
+	case LockoutKindAccount:
+		m = g.accounts
+		subject = normalizeAccount(subject)
+	case LockoutKindIP:
+		m = g.ips
+	default:
+		return false
+	}
+	if _, ok := m[subject]; !ok {
+		return false
+	}
+	delete(m, subject)
+	return true
+}
+
+// Start periodically drops entries whose failures and lockouts have expired
+func (g *LoginGuard) Start(interval time.Duration) {
+	g.stop = make(chan struct{})
+	g.done = make(chan struct{})
+	go func() {
+		defer close(g.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				g.prune()
+			case <-g.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (g *LoginGuard) Stop() {
+	if g.stop == nil {
+		return
+	}
+	close(g.stop)
+	<-g.done
+	g.stop = nil
+}
+
+func (g *LoginGuard) prune() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for _, m := range []map[string]*loginAttempts{g.accounts, g.ips} {
+		for k, a := range m {
+			if now.Sub(a.lastFailure) > g.cfg.Window && now.After(a.lockedUntil) {
+				delete(m, k)
+			}
+		}
+	}
+}
+
+func normalizeAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
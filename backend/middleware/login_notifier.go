@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type SuspiciousLoginEvent struct {
+	Reason   string    `json:"reason"`
+	Account  string    `json:"account"`
+	IP       string    `json:"ip"`
+	Failures int       `json:"failures"`
+	Time     time.Time `json:"time"`
+}
+
+// LoginNotifier is told about suspicious login activity such as lockouts
+type LoginNotifier interface {
+	NotifySuspiciousLogin(event SuspiciousLoginEvent)
+}
+
+// LogNotifier writes suspicious login events to the server log
+type LogNotifier struct{}
+
+func (LogNotifier) NotifySuspiciousLogin(e SuspiciousLoginEvent) {
+	slog.Warn("suspicious login activity", "security", true, "reason", e.Reason, "account", e.Account, "ip", e.IP, "failures", e.Failures)
+}
+
+// WebhookNotifier logs events and POSTs them as JSON to a webhook URL in the background
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+	events chan SuspiciousLoginEvent
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	n := &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		events: make(chan SuspiciousLoginEvent, 100),
+	}
+	n.wg.Add(1)
+	go n.run()
+	return n
+}
+
+func (n *WebhookNotifier) NotifySuspiciousLogin(e SuspiciousLoginEvent) {
+	LogNotifier{}.NotifySuspiciousLogin(e)
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.events <- e:
+	default:
+		slog.Warn("dropping login alert webhook, queue is full")
+	}
+}
+
+// Close delivers queued events and stops the worker
+func (n *WebhookNotifier) Close() {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.events)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+func (n *WebhookNotifier) run() {
+	defer n.wg.Done()
+	for e := range n.events {
+		body, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			slog.Warn("login alert webhook failed", "error", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn("login alert webhook rejected the event", "status", resp.StatusCode)
+		}
+	}
+}
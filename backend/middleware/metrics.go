@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"pollingPlatform/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpRequestDuration = metrics.Default.NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency by method, route and status.", metrics.DefaultBuckets, "method", "route", "status")
+	httpRequestsInFlight = metrics.Default.NewGauge("http_requests_in_flight",
+		"HTTP requests currently being handled.")
+)
+
+// Metrics records the latency of every request. Routes are labelled by their
+// pattern, e.g. /api/polls/:id, so poll IDs don't create new series.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(methodLabel(c.Request.Method), route, strconv.Itoa(c.Writer.Status())).ObserveSince(start)
+	}
+}
+
+// methodLabel folds arbitrary client-chosen methods into one series
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
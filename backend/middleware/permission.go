@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+	"pollingPlatform/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission only allows users whose role grants permission
+func RequirePermission(authz *rbac.Authorizer, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authz.Can(c.GetString("userRole"), permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"status": "error",
+				"error":  "Missing required permission: " + permission,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens   float64
+	updated  time.Time
+	lastSeen time.Time
+	period   time.Duration
+}
+
+// MemoryRateLimitStore keeps token buckets in process memory. Limits are per
+// instance, so replicas each enforce the full quota.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Take removes one token from the policy's bucket for key. Limit tokens may
+// burst and Limit tokens refill every Period.
+func (s *MemoryRateLimitStore) Take(_ context.Context, policy Policy, key string) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	id := policy.Name + "|" + key
+	capacity := float64(policy.Limit)
+	rate := capacity / policy.Period.Seconds()
+
+	b, ok := s.buckets[id]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now, period: policy.Period}
+		s.buckets[id] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	b.lastSeen = now
+
+	result := RateLimitResult{Limit: policy.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((capacity - b.tokens) / rate)
+	return result, nil
+}
+
+// Start evicts idle buckets in the background. A bucket that has been idle for
+// its whole period is full again, so dropping it doesn't change any decision.
+func (s *MemoryRateLimitStore) Start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.evictIdle()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *MemoryRateLimitStore) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+func (s *MemoryRateLimitStore) evictIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, b := range s.buckets {
+		if now.Sub(b.lastSeen) >= b.period {
+			delete(s.buckets, id)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"pollingPlatform/health"
+	"pollingPlatform/metrics"
+	"pollingPlatform/repository"
+	"pollingPlatform/tracing"
+	"sync"
+	"time"
+)
+
+// PostgresRateLimitStore shares quotas between instances using a sliding window
+// counter: the previous window's count is weighted by how much of it still overlaps
+// the sliding window, which approximates a true sliding log with two rows per key.
+type PostgresRateLimitStore struct {
+	repo *repository.RateLimitRepository
+
+	mu        sync.Mutex
+	maxPeriod time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewPostgresRateLimitStore(repo *repository.RateLimitRepository) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{repo: repo}
+}
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, policy Policy, key string) (RateLimitResult, error) {
+	s.trackPeriod(policy.Period)
+
+	now := time.Now()
+	current, previous, allowed, err := s.repo.WithContext(ctx).SlidingWindowHit(policy.Name+"|"+key, now, policy.Period, policy.Limit)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	windowEnd := now.Truncate(policy.Period).Add(policy.Period)
+	elapsed := 1 - float64(windowEnd.Sub(now))/float64(policy.Period)
+	estimate := float64(previous)*(1-elapsed) + float64(current)
+
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: int(math.Max(0, float64(policy.Limit)-math.Ceil(estimate))),
+		Reset:     windowEnd.Sub(now) + policy.Period,
+	}
+	if !allowed {
+		result.RetryAfter = windowEnd.Sub(now)
+		// Within this window a slot frees up once enough of the previous window has slid out
+		if previous > 0 && current < policy.Limit {
+			needed := float64(current+1-policy.Limit)/float64(previous) + 1
+			if wait := time.Duration((needed - elapsed) * float64(policy.Period)); wait > 0 && wait < result.RetryAfter {
+				result.RetryAfter = wait
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *PostgresRateLimitStore) trackPeriod(period time.Duration) {
+	s.mu.Lock()
+	if period > s.maxPeriod {
+		s.maxPeriod = period
+	}
+	s.mu.Unlock()
+}
+
+// Start periodically deletes counters older than two windows of the longest policy
+func (s *PostgresRateLimitStore) Start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.mu.Lock()
+				retention := 2 * s.maxPeriod
+				s.mu.Unlock()
+				if retention == 0 {
+					continue
+				}
+				start := time.Now()
+				err := tracing.RunJob("rate_limit_cleanup", func(ctx context.Context) error {
+					return s.repo.WithContext(ctx).DeleteCountersBefore(start.Add(-retention))
+				})
+				metrics.RecordJob("rate_limit_cleanup", start, err)
+				health.RecordJob("rate_limit_cleanup", err)
+				if err != nil {
+					slog.Warn("cleaning up rate limit counters failed", "error", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *PostgresRateLimitStore) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
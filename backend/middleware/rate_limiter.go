@@ -1,57 +1,106 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"net/http"
-	"sync"
+	"pollingPlatform/logging"
+	"pollingPlatform/metrics"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-type RateLimiter struct {
-	requests map[string][]time.Time
-	mu       sync.Mutex
-	limit    int
-	window   time.Duration
+// KeyFunc identifies who a request is counted against
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP counts requests per client IP
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser counts authenticated requests per user and anonymous ones per IP
+func KeyByUser(c *gin.Context) string {
+	if userID, exists := c.Get("userID"); exists {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return KeyByIP(c)
 }
 
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
+// KeyByAPIKey counts personal access token requests per token, everything else per user
+func KeyByAPIKey(c *gin.Context) string {
+	if tokenID, exists := c.Get("tokenID"); exists {
+		return fmt.Sprintf("token:%v", tokenID)
 	}
+	return KeyByUser(c)
+}
+
+var rateLimitRejections = metrics.Default.NewCounterVec("rate_limit_rejections_total",
+	"Requests rejected with 429 by rate limit policy.", "policy")
+
+// Policy allows Limit requests per Period for each key
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Key    KeyFunc
+}
+
+// RateLimitResult is the outcome of counting one request against a policy
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the full quota is available again
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts requests. Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	Take(ctx context.Context, policy Policy, key string) (RateLimitResult, error)
+	// Start begins background cleanup of expired state; Stop ends it
+	Start(interval time.Duration)
+	Stop()
+}
+
+type RateLimiter struct {
+	store RateLimitStore
+}
+
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	return &RateLimiter{store: store}
 }
 
-func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+// Middleware enforces policy and sets RateLimit-* headers on every response
+func (rl *RateLimiter) Middleware(policy Policy) gin.HandlerFunc {
+	keyFunc := policy.Key
+	if keyFunc == nil {
+		keyFunc = KeyByUser
+	}
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Period.Seconds()))
+
 	return func(c *gin.Context) {
-		userID, exists := c.Get("userID")
-		if !exists {
+		result, err := rl.store.Take(c.Request.Context(), policy, keyFunc(c))
+		if err != nil {
+			// Fail open: a broken limiter store must not take the API down
+			logging.FromContext(c.Request.Context()).Warn("rate limit store failed, allowing request", "policy", policy.Name, "error", err)
 			c.Next()
 			return
 		}
 
-		key := fmt.Sprintf("%v", userID)
-		rl.mu.Lock()
-		defer rl.mu.Unlock()
-
-		now := time.Now()
-		windowStart := now.Add(-rl.window)
-
-		// Clean old requests
-		if requests, ok := rl.requests[key]; ok {
-			var validRequests []time.Time
-			for _, t := range requests {
-				if t.After(windowStart) {
-					validRequests = append(validRequests, t)
-				}
-			}
-			rl.requests[key] = validRequests
-		}
+		c.Header("RateLimit-Policy", policyHeader)
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
 
-		// Check limit
-		if len(rl.requests[key]) >= rl.limit {
+		if !result.Allowed {
+			rateLimitRejections.WithLabelValues(policy.Name).Inc()
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"status": "error",
 				"error":  "Rate limit exceeded. Please try again later.",
@@ -60,8 +109,45 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 			return
 		}
 
-		// Add current request
-		rl.requests[key] = append(rl.requests[key], now)
 		c.Next()
 	}
 }
+
+// ParsePolicyOverrides applies "name=limit/period" overrides, e.g. "vote=200/1m,poll-create=5/1h"
+func ParsePolicyOverrides(policies map[string]Policy, overrides string) error {
+	for _, entry := range strings.Split(overrides, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		limitStr, periodStr, ok2 := strings.Cut(spec, "/")
+		if !ok || !ok2 {
+			return fmt.Errorf("invalid rate limit %q, expected name=limit/period", entry)
+		}
+		policy, exists := policies[strings.TrimSpace(name)]
+		if !exists {
+			return fmt.Errorf("unknown rate limit policy %q", name)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+		if err != nil || limit < 1 {
+			return fmt.Errorf("invalid limit in %q", entry)
+		}
+		period, err := time.ParseDuration(strings.TrimSpace(periodStr))
+		if err != nil || period <= 0 {
+			return fmt.Errorf("invalid period in %q", entry)
+		}
+		policy.Limit = limit
+		policy.Period = period
+		policies[policy.Name] = policy
+	}
+	return nil
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,150 @@
+package migrations_test
+
+import (
+	"context"
+	"pollingPlatform/migrations"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// The models as they were when the schema was created by AutoMigrate
+type (
+	User struct {
+		gorm.Model
+		Username     string
+		Email        string
+		Password     string
+		Role         string
+		RefreshToken string
+	}
+	Poll struct {
+		gorm.Model
+		Title       string
+		Description string
+		EndDate     time.Time
+		Options     []Option
+	}
+	Option struct {
+		gorm.Model
+		PollID uint
+		Text   string
+		Votes  int
+	}
+	Vote struct {
+		gorm.Model
+		PollID   uint `gorm:"index:idx_user_poll,unique"`
+		OptionID uint
+		UserID   uint `gorm:"index:idx_user_poll,unique"`
+	}
+)
+
+func TestAdoptBaselineSchema(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open("file::memory:?_pragma=foreign_keys(1)"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&User{}, &Poll{}, &Option{}, &Vote{}); err != nil {
+		t.Fatal(err)
+	}
+	legacy := Poll{Title: "Legacy", EndDate: time.Now().Add(time.Hour), Options: []Option{{Text: "a"}, {Text: "b"}}}
+	if err := db.Create(&User{Username: "old", Email: "old@example.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := migrations.New(sqlDB, migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrating a baseline database: %v", err)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending != 0 {
+		t.Fatalf("pending %d, %v", pending, err)
+	}
+
+	var user struct {
+		Version int
+		Plan    string
+	}
+	if err := db.Raw(`SELECT version, plan FROM users WHERE username = 'old'`).Scan(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Version != 1 || user.Plan != "free" {
+		t.Errorf("existing user got version %d, plan %q", user.Version, user.Plan)
+	}
+	var poll struct {
+		Version int
+		UserID  *uint
+	}
+	if err := db.Raw(`SELECT version, user_id FROM polls WHERE id = ?`, legacy.ID).Scan(&poll).Error; err != nil {
+		t.Fatal(err)
+	}
+	if poll.Version != 1 || poll.UserID != nil {
+		t.Errorf("existing poll got version %d, user %v", poll.Version, poll.UserID)
+	}
+
+	// Reverting stops at the baseline, leaving the original tables and rows alone
+	all, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := migrator.Down(ctx, len(all))
+	if len(reverted) != len(all)-1 || err == nil || !strings.Contains(err.Error(), "cannot be reverted") {
+		t.Fatalf("reverted %d migrations, %v", len(reverted), err)
+	}
+	var count int64
+	if err := db.Raw(`SELECT count(*) FROM polls`).Scan(&count).Error; err != nil || count != 1 {
+		t.Fatalf("baseline rows after reverting: %d, %v", count, err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrating again: %v", err)
+	}
+}
+
+func TestPendingRunsNoDDL(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrations.New(sqlDB, migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Pending(ctx); err == nil {
+		t.Fatal("Pending succeeded on a database that was never migrated")
+	}
+	if db.Migrator().HasTable("schema_migrations") {
+		t.Fatal("Pending created the version table")
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending != 0 {
+		t.Fatalf("pending %d, %v", pending, err)
+	}
+}
@@ -0,0 +1,52 @@
+-- The schema the models had before versioned migrations, as created by AutoMigrate.
+-- It is IF NOT EXISTS so databases from that time start tracking migrations
+-- unchanged; 0002 brings them up to date. Whether these tables existed before can't
+-- be told afterwards, so this migration has no down file and can't be reverted.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    username text,
+    email text,
+    password text,
+    role text,
+    refresh_token text
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS polls (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    title text,
+    description text,
+    end_date timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_polls_deleted_at ON polls (deleted_at);
+
+CREATE TABLE IF NOT EXISTS options (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    poll_id bigint,
+    text text,
+    votes bigint,
+    CONSTRAINT fk_polls_options FOREIGN KEY (poll_id) REFERENCES polls (id)
+);
+CREATE INDEX IF NOT EXISTS idx_options_deleted_at ON options (deleted_at);
+
+CREATE TABLE IF NOT EXISTS votes (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    poll_id bigint,
+    option_id bigint,
+    user_id bigint
+);
+CREATE INDEX IF NOT EXISTS idx_votes_deleted_at ON votes (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_poll ON votes (poll_id, user_id);
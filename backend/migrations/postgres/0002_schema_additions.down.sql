@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS idempotency_records;
+DROP TABLE IF EXISTS plans;
+DROP TABLE IF EXISTS rate_limit_counters;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS signing_keys;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS option_vote_shards;
+
+DROP INDEX IF EXISTS idx_polls_user_id;
+ALTER TABLE polls DROP COLUMN IF EXISTS version;
+ALTER TABLE polls DROP COLUMN IF EXISTS high_traffic;
+ALTER TABLE polls DROP COLUMN IF EXISTS user_id;
+
+DROP INDEX IF EXISTS idx_oidc_identity;
+ALTER TABLE users DROP COLUMN IF EXISTS plan;
+ALTER TABLE users DROP COLUMN IF EXISTS oidc_subject;
+ALTER TABLE users DROP COLUMN IF EXISTS oidc_issuer;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
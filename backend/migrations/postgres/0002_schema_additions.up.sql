@@ -0,0 +1,122 @@
+-- Columns and tables added since the baseline schema.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_issuer text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS plan text DEFAULT 'free';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oidc_identity ON users (oidc_issuer, oidc_subject) WHERE oidc_subject <> '';
+
+ALTER TABLE polls ADD COLUMN IF NOT EXISTS user_id bigint;
+ALTER TABLE polls ADD COLUMN IF NOT EXISTS high_traffic boolean;
+ALTER TABLE polls ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS idx_polls_user_id ON polls (user_id);
+
+CREATE TABLE IF NOT EXISTS option_vote_shards (
+    option_id bigint,
+    shard bigint,
+    votes bigint,
+    PRIMARY KEY (option_id, shard)
+);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    name text,
+    prefix text,
+    token_hash text,
+    scopes text,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    last_used_ip text,
+    revoked_at timestamptz,
+    CONSTRAINT fk_personal_access_tokens_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_deleted_at ON personal_access_tokens (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    kid text,
+    algorithm text,
+    private_key text,
+    retires_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_deleted_at ON signing_keys (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_signing_keys_kid ON signing_keys (kid);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_retires_at ON signing_keys (retires_at);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text,
+    description text
+);
+CREATE INDEX IF NOT EXISTS idx_permissions_deleted_at ON permissions (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_permissions_name ON permissions (name);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text,
+    description text,
+    built_in boolean
+);
+CREATE INDEX IF NOT EXISTS idx_roles_deleted_at ON roles (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name ON roles (name);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id bigint,
+    permission_id bigint,
+    PRIMARY KEY (role_id, permission_id),
+    CONSTRAINT fk_role_permissions_role FOREIGN KEY (role_id) REFERENCES roles (id),
+    CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission_id) REFERENCES permissions (id)
+);
+
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key varchar(255),
+    window_start timestamptz,
+    count bigint,
+    PRIMARY KEY (key, window_start)
+);
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_window_start ON rate_limit_counters (window_start);
+
+CREATE TABLE IF NOT EXISTS plans (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text,
+    description text,
+    max_active_polls bigint,
+    max_options_per_poll bigint,
+    max_votes_per_month bigint
+);
+CREATE INDEX IF NOT EXISTS idx_plans_deleted_at ON plans (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_plans_name ON plans (name);
+
+CREATE TABLE IF NOT EXISTS idempotency_records (
+    id bigserial PRIMARY KEY,
+    user_id bigint,
+    key varchar(255),
+    method text,
+    path text,
+    request_hash text,
+    status_code bigint,
+    content_type text,
+    response_body bytea,
+    created_at timestamptz,
+    expires_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_user_key ON idempotency_records (user_id, key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_records_expires_at ON idempotency_records (expires_at);
@@ -0,0 +1,53 @@
+-- The schema the models had before versioned migrations, as created by AutoMigrate,
+-- kept equivalent to the Postgres one.
+-- It is IF NOT EXISTS so databases from that time start tracking migrations
+-- unchanged; 0002 brings them up to date. Whether these tables existed before can't
+-- be told afterwards, so this migration has no down file and can't be reverted.
+
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    username text,
+    email text,
+    password text,
+    role text,
+    refresh_token text
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS polls (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    title text,
+    description text,
+    end_date datetime
+);
+CREATE INDEX IF NOT EXISTS idx_polls_deleted_at ON polls (deleted_at);
+
+CREATE TABLE IF NOT EXISTS options (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    poll_id integer,
+    text text,
+    votes integer,
+    CONSTRAINT fk_polls_options FOREIGN KEY (poll_id) REFERENCES polls (id)
+);
+CREATE INDEX IF NOT EXISTS idx_options_deleted_at ON options (deleted_at);
+
+CREATE TABLE IF NOT EXISTS votes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    poll_id integer,
+    option_id integer,
+    user_id integer
+);
+CREATE INDEX IF NOT EXISTS idx_votes_deleted_at ON votes (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_poll ON votes (poll_id, user_id);
@@ -0,0 +1,124 @@
+-- Columns and tables added since the baseline schema.
+-- SQLite databases were always created by migrations, so the columns are added
+-- unconditionally.
+
+ALTER TABLE users ADD COLUMN version integer NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN oidc_issuer text;
+ALTER TABLE users ADD COLUMN oidc_subject text;
+ALTER TABLE users ADD COLUMN plan text DEFAULT 'free';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oidc_identity ON users (oidc_issuer, oidc_subject) WHERE oidc_subject <> '';
+
+ALTER TABLE polls ADD COLUMN user_id integer;
+ALTER TABLE polls ADD COLUMN high_traffic numeric;
+ALTER TABLE polls ADD COLUMN version integer NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS idx_polls_user_id ON polls (user_id);
+
+CREATE TABLE IF NOT EXISTS option_vote_shards (
+    option_id integer,
+    shard integer,
+    votes integer,
+    PRIMARY KEY (option_id, shard)
+);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    user_id integer,
+    name text,
+    prefix text,
+    token_hash text,
+    scopes text,
+    expires_at datetime,
+    last_used_at datetime,
+    last_used_ip text,
+    revoked_at datetime,
+    CONSTRAINT fk_personal_access_tokens_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_deleted_at ON personal_access_tokens (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    kid text,
+    algorithm text,
+    private_key text,
+    retires_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_deleted_at ON signing_keys (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_signing_keys_kid ON signing_keys (kid);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_retires_at ON signing_keys (retires_at);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name text,
+    description text
+);
+CREATE INDEX IF NOT EXISTS idx_permissions_deleted_at ON permissions (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_permissions_name ON permissions (name);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name text,
+    description text,
+    built_in numeric
+);
+CREATE INDEX IF NOT EXISTS idx_roles_deleted_at ON roles (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name ON roles (name);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id integer,
+    permission_id integer,
+    PRIMARY KEY (role_id, permission_id),
+    CONSTRAINT fk_role_permissions_role FOREIGN KEY (role_id) REFERENCES roles (id),
+    CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission_id) REFERENCES permissions (id)
+);
+
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key varchar(255),
+    window_start datetime,
+    count integer,
+    PRIMARY KEY (key, window_start)
+);
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_window_start ON rate_limit_counters (window_start);
+
+CREATE TABLE IF NOT EXISTS plans (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name text,
+    description text,
+    max_active_polls integer,
+    max_options_per_poll integer,
+    max_votes_per_month integer
+);
+CREATE INDEX IF NOT EXISTS idx_plans_deleted_at ON plans (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_plans_name ON plans (name);
+
+CREATE TABLE IF NOT EXISTS idempotency_records (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer,
+    key varchar(255),
+    method text,
+    path text,
+    request_hash text,
+    status_code integer,
+    content_type text,
+    response_body blob,
+    created_at datetime,
+    expires_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_user_key ON idempotency_records (user_id, key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_records_expires_at ON idempotency_records (expires_at);
@@ -0,0 +1,5 @@
+-- updated_at marks when a pending idempotency reservation was taken, so a reservation
+-- left behind by a crashed process can be claimed again once its lease runs out.
+
+ALTER TABLE idempotency_records ADD COLUMN updated_at datetime;
+UPDATE idempotency_records SET updated_at = created_at WHERE updated_at IS NULL;
@@ -11,19 +11,30 @@ import (
 
 type User struct {
 	gorm.Model
-	Username     string `json:"username" binding:"required,min=3,max=30"`
-	Email        string `json:"email" binding:"required,email"`
-	Password     string `json:"password" binding:"required,min=6"`
-	Role         string `json:"role" default:"user"`
+	Username string `json:"username" binding:"required,min=3,max=30"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
+	Role     string `json:"role" default:"user"`
+	// Version increases with every update, for optimistic concurrency control
+	Version      uint   `json:"version" gorm:"not null;default:1"`
 	RefreshToken string `json:"-"`
+	// An identity links to at most one account; local accounts leave both empty
+	OIDCIssuer  string `json:"-" gorm:"column:oidc_issuer;uniqueIndex:idx_oidc_identity,where:oidc_subject <> ''"`
+	OIDCSubject string `json:"-" gorm:"column:oidc_subject;uniqueIndex:idx_oidc_identity"`
+	Plan        string `json:"plan" gorm:"default:free"`
 }
 
 type Poll struct {
 	gorm.Model
+	UserID      uint      `json:"userId" gorm:"index"`
 	Title       string    `json:"title" binding:"required,min=3,max=100"`
 	Description string    `json:"description" binding:"required,max=500"`
 	EndDate     time.Time `json:"endDate" binding:"required"` // Remove 'future' tag
 	Options     []Option  `json:"options" binding:"required,min=2,dive"`
+	// HighTraffic polls count votes in sharded counter rows instead of the option row
+	HighTraffic bool `json:"highTraffic"`
+	// Version increases with every edit, for optimistic concurrency control
+	Version uint `json:"version" gorm:"not null;default:1"`
 }
 
 type Option struct {
@@ -33,6 +44,14 @@ type Option struct {
 	Votes  int    `json:"votes"`
 }
 
+// OptionVoteShard holds part of a high-traffic option's vote count. An option's
+// total is its Votes plus the sum of its shards.
+type OptionVoteShard struct {
+	OptionID uint `gorm:"primaryKey;autoIncrement:false"`
+	Shard    int  `gorm:"primaryKey;autoIncrement:false"`
+	Votes    int
+}
+
 type Vote struct {
 	gorm.Model
 	PollID   uint `json:"pollId" binding:"required" gorm:"index:idx_user_poll,unique"`
@@ -40,6 +59,113 @@ type Vote struct {
 	UserID   uint `json:"userId" binding:"required" gorm:"index:idx_user_poll,unique"`
 }
 
+type Permission struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
+}
+
+type Role struct {
+	gorm.Model
+	Name        string       `json:"name" gorm:"uniqueIndex"`
+	Description string       `json:"description"`
+	BuiltIn     bool         `json:"builtIn"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;"`
+}
+
+// Plan sets a user's long-term quotas; 0 means unlimited
+type Plan struct {
+	gorm.Model
+	Name              string `json:"name" gorm:"uniqueIndex"`
+	Description       string `json:"description"`
+	MaxActivePolls    int    `json:"maxActivePolls"`
+	MaxOptionsPerPoll int    `json:"maxOptionsPerPoll"`
+	MaxVotesPerMonth  int    `json:"maxVotesPerMonth"`
+}
+
+// Scopes that can be granted to personal access tokens
+const (
+	ScopePollsRead  = "polls:read"
+	ScopePollsWrite = "polls:write"
+	ScopeVotesWrite = "votes:write"
+)
+
+var ValidScopes = []string{ScopePollsRead, ScopePollsWrite, ScopeVotesWrite}
+
+type PersonalAccessToken struct {
+	gorm.Model
+	UserID     uint       `json:"userId" gorm:"index"`
+	User       User       `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	Scopes     string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// ScopeList returns the token's scopes as a slice
+func (t *PersonalAccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope reports whether the token was granted scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUsable reports whether the token is neither revoked nor expired
+func (t *PersonalAccessToken) IsUsable() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
+
+// SigningKey is a JWT signing key pair. The private key is stored encrypted.
+type SigningKey struct {
+	gorm.Model
+	KID        string    `json:"kid" gorm:"column:kid;uniqueIndex"`
+	Algorithm  string    `json:"algorithm"`
+	PrivateKey string    `json:"-"`
+	RetiresAt  time.Time `json:"retiresAt" gorm:"index"`
+}
+
+// RateLimitCounter counts requests for one key in one fixed window
+type RateLimitCounter struct {
+	Key         string    `gorm:"primaryKey;size:255"`
+	WindowStart time.Time `gorm:"primaryKey;index"`
+	Count       int
+}
+
+// IdempotencyRecord stores the first response to a request made with an Idempotency-Key.
+// StatusCode stays 0 while the original request is still being processed; UpdatedAt
+// then dates the reservation.
+type IdempotencyRecord struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"uniqueIndex:idx_idempotency_user_key"`
+	Key          string `gorm:"uniqueIndex:idx_idempotency_user_key;size:255"`
+	Method       string
+	Path         string
+	RequestHash  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
 // ValidateUser validates user data before creation
 func (u *User) ValidateUser() error {
 	// Username validations
@@ -97,19 +223,12 @@ func (u *User) ValidateUser() error {
 		return errors.New("password must contain at least one uppercase letter, one lowercase letter, and one number")
 	}
 
-	// Role validation
-	if u.Role == "" {
-		u.Role = "user" // Set default role
-	}
-	if u.Role != "user" && u.Role != "admin" {
-		return errors.New("invalid role")
-	}
-
 	return nil
 }
 
-// ValidatePoll validates a poll before creation
-func (p *Poll) ValidatePoll() error {
+// ValidateDetails validates the fields that can still be edited after creation.
+// Edits are only allowed while the poll is active, which callers check first.
+func (p *Poll) ValidateDetails() error {
 	// Title validations
 	title := strings.TrimSpace(p.Title)
 	if title == "" {
@@ -153,6 +272,15 @@ func (p *Poll) ValidatePoll() error {
 		return errors.New("poll duration cannot exceed 30 days")
 	}
 
+	return nil
+}
+
+// ValidatePoll validates a poll before creation
+func (p *Poll) ValidatePoll() error {
+	if err := p.ValidateDetails(); err != nil {
+		return err
+	}
+
 	// Options validations
 	if len(p.Options) < 2 {
 		return errors.New("poll must have at least 2 options")
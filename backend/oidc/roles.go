@@ -0,0 +1,48 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RoleMapping assigns Role to users who are members of Group
+type RoleMapping struct {
+	Group string
+	Role  string
+}
+
+// DefaultRole is assigned when none of the user's groups is mapped
+const DefaultRole = "user"
+
+// ParseRoleMappings parses "group=role,other-group=role" into ordered mappings.
+// Earlier entries take precedence when a user matches several groups.
+func ParseRoleMappings(s string) ([]RoleMapping, error) {
+	var mappings []RoleMapping
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid role mapping %q, expected group=role", pair)
+		}
+		mappings = append(mappings, RoleMapping{Group: group, Role: role})
+	}
+	return mappings, nil
+}
+
+// MapRole returns the role of the first mapping matching one of the groups
+func MapRole(mappings []RoleMapping, groups []string) string {
+	member := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		member[g] = true
+	}
+	for _, m := range mappings {
+		if member[m.Group] {
+			return m.Role
+		}
+	}
+	return DefaultRole
+}
@@ -0,0 +1,60 @@
+package oidc
+
+import (
+	"sync"
+	"time"
+)
+
+// PendingLogin is what we remember between the redirect and the callback
+type PendingLogin struct {
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+}
+
+// StateStore keeps pending logins keyed by the OAuth2 state parameter
+type StateStore struct {
+	mu      sync.Mutex
+	pending map[string]PendingLogin
+	ttl     time.Duration
+}
+
+func NewStateStore(ttl time.Duration) *StateStore {
+	return &StateStore{
+		pending: make(map[string]PendingLogin),
+		ttl:     ttl,
+	}
+}
+
+func (s *StateStore) Save(state string, login PendingLogin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired entries so abandoned logins don't accumulate
+	now := time.Now()
+	for k, v := range s.pending {
+		if now.Sub(v.CreatedAt) > s.ttl {
+			delete(s.pending, k)
+		}
+	}
+
+	login.CreatedAt = now
+	s.pending[state] = login
+}
+
+// Take returns and removes the pending login for state; each state is single-use
+func (s *StateStore) Take(state string) (PendingLogin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.pending[state]
+	if !ok {
+		return PendingLogin{}, false
+	}
+	delete(s.pending, state)
+
+	if time.Since(login.CreatedAt) > s.ttl {
+		return PendingLogin{}, false
+	}
+	return login, true
+}
@@ -0,0 +1,173 @@
+// Package quota enforces the long-term limits of a user's plan.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pollingPlatform/models"
+	"pollingPlatform/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPlan is assigned to new users
+const DefaultPlan = "free"
+
+// Quota names reported in errors and usage
+const (
+	QuotaActivePolls    = "active_polls"
+	QuotaOptionsPerPoll = "options_per_poll"
+	QuotaVotesPerMonth  = "votes_per_month"
+)
+
+// BuiltInPlans are created on startup if missing; admins can change them afterwards
+var BuiltInPlans = []models.Plan{
+	{Name: DefaultPlan, Description: "Free tier", MaxActivePolls: 5, MaxOptionsPerPoll: 5, MaxVotesPerMonth: 500},
+	{Name: "pro", Description: "For teams running polls regularly", MaxActivePolls: 50, MaxOptionsPerPoll: 10, MaxVotesPerMonth: 10000},
+	{Name: "unlimited", Description: "No quotas"},
+}
+
+// ExceededError reports which quota a request would exceed
+type ExceededError struct {
+	Quota string
+	Limit int
+	Used  int
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota %s exceeded: %d of %d used", e.Quota, e.Used, e.Limit)
+}
+
+// Usage is a user's current consumption against their plan
+type Usage struct {
+	Plan           string     `json:"plan"`
+	ActivePolls    UsageEntry `json:"activePolls"`
+	OptionsPerPoll UsageEntry `json:"optionsPerPoll"`
+	VotesThisMonth UsageEntry `json:"votesThisMonth"`
+	PeriodStart    time.Time  `json:"periodStart"`
+	PeriodEnd      time.Time  `json:"periodEnd"`
+}
+
+// UsageEntry is the consumption of one quota; a Limit of 0 means unlimited
+type UsageEntry struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit"`
+}
+
+type Service struct {
+	plans *repository.PlanRepository
+	users repository.UserStore
+	polls repository.PollStore
+}
+
+func NewService(plans *repository.PlanRepository, users repository.UserStore, polls repository.PollStore) *Service {
+	return &Service{plans: plans, users: users, polls: polls}
+}
+
+// WithContext returns a service whose poll and user lookups run under ctx
+func (s *Service) WithContext(ctx context.Context) *Service {
+	return &Service{plans: s.plans, users: s.users.WithContext(ctx), polls: s.polls.WithContext(ctx)}
+}
+
+// Seed creates the built-in plans that don't exist yet
+func (s *Service) Seed() error {
+	for _, p := range BuiltInPlans {
+		plan := p
+		if err := s.plans.EnsurePlan(&plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PollCreationCheck verifies the user may create a poll with optionCount options and
+// returns the check of their active polls for PollStore.CreatePollWithin, which runs
+// it in the creating transaction. The check is nil for plans without a limit.
+func (s *Service) PollCreationCheck(userID uint, optionCount int) (repository.UsageCheck, error) {
+	plan, err := s.planFor(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.MaxOptionsPerPoll > 0 && optionCount > plan.MaxOptionsPerPoll {
+		return nil, &ExceededError{Quota: QuotaOptionsPerPoll, Limit: plan.MaxOptionsPerPoll, Used: optionCount}
+	}
+	return limitCheck(QuotaActivePolls, plan.MaxActivePolls), nil
+}
+
+// VoteCheck returns the check of the user's votes this month for
+// PollStore.CastVoteWithin, along with the start of the month it counts from. The
+// check is nil for plans without a limit.
+func (s *Service) VoteCheck(userID uint) (time.Time, repository.UsageCheck, error) {
+	plan, err := s.planFor(userID)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	return monthStart(time.Now()), limitCheck(QuotaVotesPerMonth, plan.MaxVotesPerMonth), nil
+}
+
+// limitCheck fails with an ExceededError once used reaches limit; 0 means unlimited
+func limitCheck(quota string, limit int) repository.UsageCheck {
+	if limit <= 0 {
+		return nil
+	}
+	return func(used int64) error {
+		if int(used) >= limit {
+			return &ExceededError{Quota: quota, Limit: limit, Used: int(used)}
+		}
+		return nil
+	}
+}
+
+// Usage reports the user's consumption of every quota
+func (s *Service) Usage(userID uint) (*Usage, error) {
+	plan, err := s.planFor(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := s.polls.CountActivePollsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	start := monthStart(time.Now())
+	votes, err := s.polls.CountVotesByUserSince(userID, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Usage{
+		Plan:           plan.Name,
+		ActivePolls:    UsageEntry{Used: int(active), Limit: plan.MaxActivePolls},
+		OptionsPerPoll: UsageEntry{Limit: plan.MaxOptionsPerPoll},
+		VotesThisMonth: UsageEntry{Used: int(votes), Limit: plan.MaxVotesPerMonth},
+		PeriodStart:    start,
+		PeriodEnd:      start.AddDate(0, 1, 0),
+	}, nil
+}
+
+func (s *Service) planFor(userID uint) (*models.Plan, error) {
+	user, err := s.users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := user.Plan
+	if name == "" {
+		name = DefaultPlan
+	}
+	plan, err := s.plans.GetPlanByName(name)
+	if errors.Is(err, gorm.ErrRecordNotFound) && name != DefaultPlan {
+		// A deleted or misspelled plan falls back to the default instead of blocking the user
+		plan, err = s.plans.GetPlanByName(DefaultPlan)
+	}
+	return plan, err
+}
+
+// monthStart returns the first instant of t's month in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
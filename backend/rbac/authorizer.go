@@ -0,0 +1,180 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"pollingPlatform/health"
+	"pollingPlatform/metrics"
+	"pollingPlatform/models"
+	"pollingPlatform/repository"
+	"pollingPlatform/tracing"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Authorizer caches the permissions granted by each role
+type Authorizer struct {
+	repo *repository.RoleRepository
+
+	mu    sync.RWMutex
+	roles map[string]map[string]bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewAuthorizer(repo *repository.RoleRepository) *Authorizer {
+	return &Authorizer{
+		repo:  repo,
+		roles: make(map[string]map[string]bool),
+	}
+}
+
+// Seed creates the built-in permissions and roles that are missing and loads the cache.
+// Roles that already exist keep whatever permissions an admin gave them.
+func (a *Authorizer) Seed() error {
+	for _, p := range Permissions {
+		if err := a.repo.EnsurePermission(p.Name, p.Description); err != nil {
+			return err
+		}
+	}
+
+	for _, def := range BuiltInRoles {
+		_, err := a.repo.GetRoleByName(def.Name)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		role := models.Role{Name: def.Name, Description: def.Description, BuiltIn: true}
+		if err := a.repo.CreateRole(&role, def.Permissions); err != nil {
+			return err
+		}
+	}
+
+	return a.Reload()
+}
+
+// Reload refreshes the cached role permissions from the database
+func (a *Authorizer) Reload() error {
+	return a.reload(a.repo)
+}
+
+func (a *Authorizer) reload(repo *repository.RoleRepository) error {
+	roles, err := repo.ListRoles()
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[string]map[string]bool, len(roles))
+	for _, role := range roles {
+		perms := make(map[string]bool, len(role.Permissions))
+		for _, p := range role.Permissions {
+			perms[p.Name] = true
+		}
+		cache[role.Name] = perms
+	}
+
+	a.mu.Lock()
+	a.roles = cache
+	a.mu.Unlock()
+	return nil
+}
+
+// Can reports whether role grants permission
+func (a *Authorizer) Can(role, permission string) bool {
+	if role == AdminRole {
+		return true
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.roles[role][permission]
+}
+
+// CanGrant reports whether a holder of grantor may hand out every one of permissions.
+// Nobody but an admin can grant a permission they don't hold themselves.
+func (a *Authorizer) CanGrant(grantor string, permissions []string) bool {
+	if grantor == AdminRole {
+		return true
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, p := range permissions {
+		if !a.roles[grantor][p] {
+			return false
+		}
+	}
+	return true
+}
+
+// CanGrantRole reports whether a holder of grantor may assign role to a user, take it
+// away or change it. Only admins can do that for admin; everyone else only for roles
+// whose permissions they all hold. An unknown role has no permissions to compare, so
+// only admins may move users off it.
+func (a *Authorizer) CanGrantRole(grantor, role string) bool {
+	if grantor == AdminRole {
+		return true
+	}
+	if role == AdminRole {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if _, ok := a.roles[role]; !ok {
+		return false
+	}
+	for p := range a.roles[role] {
+		if !a.roles[grantor][p] {
+			return false
+		}
+	}
+	return true
+}
+
+// RoleExists reports whether role is defined
+func (a *Authorizer) RoleExists(role string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.roles[role]
+	return ok
+}
+
+// Start reloads the cache periodically so changes made on other instances are picked up
+func (a *Authorizer) Start(interval time.Duration) {
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				start := time.Now()
+				err := tracing.RunJob("role_reload", func(ctx context.Context) error {
+					return a.reload(a.repo.WithContext(ctx))
+				})
+				metrics.RecordJob("role_reload", start, err)
+				health.RecordJob("role_reload", err)
+				if err != nil {
+					slog.Warn("reloading roles failed", "error", err)
+				}
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (a *Authorizer) Stop() {
+	if a.stop == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+	a.stop = nil
+}
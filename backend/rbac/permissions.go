@@ -0,0 +1,74 @@
+// Package rbac resolves roles to permissions.
+package rbac
+
+// Permissions checked by route middleware
+const (
+	PermPollsCreate    = "polls:create"
+	PermPollsVote      = "polls:vote"
+	PermPollsManage    = "polls:manage"
+	PermUsersManage    = "users:manage"
+	PermRolesManage    = "roles:manage"
+	PermSecurityManage = "security:manage"
+	PermPlansManage    = "plans:manage"
+)
+
+// DefaultRole is assigned to newly registered users
+const DefaultRole = "user"
+
+// AdminRole always holds every permission
+const AdminRole = "admin"
+
+type PermissionDef struct {
+	Name        string
+	Description string
+}
+
+var Permissions = []PermissionDef{
+	{PermPollsCreate, "Create polls"},
+	{PermPollsVote, "Vote on polls"},
+	{PermPollsManage, "Edit or remove any poll"},
+	{PermUsersManage, "Assign roles to users"},
+	{PermRolesManage, "Create roles and change their permissions"},
+	{PermSecurityManage, "View and clear login lockouts"},
+	{PermPlansManage, "Manage plans and assign them to users"},
+}
+
+type RoleDef struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// BuiltInRoles are created on startup if they don't exist yet
+var BuiltInRoles = []RoleDef{
+	{
+		Name:        DefaultRole,
+		Description: "Regular user",
+		Permissions: []string{PermPollsCreate, PermPollsVote},
+	},
+	{
+		Name:        "poll-manager",
+		Description: "Manages polls created by anyone",
+		Permissions: []string{PermPollsCreate, PermPollsVote, PermPollsManage},
+	},
+	{
+		Name:        "moderator",
+		Description: "Moderates polls and handles account lockouts",
+		Permissions: []string{PermPollsCreate, PermPollsVote, PermPollsManage, PermSecurityManage},
+	},
+	{
+		Name:        AdminRole,
+		Description: "Full access",
+		Permissions: []string{PermPollsCreate, PermPollsVote, PermPollsManage, PermUsersManage, PermRolesManage, PermSecurityManage, PermPlansManage},
+	},
+}
+
+// IsKnownPermission reports whether name is one of the defined permissions
+func IsKnownPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// Package reconcile checks the denormalized option vote counters against the ballots
+// actually recorded and optionally repairs them.
+package reconcile
+
+import (
+	"context"
+	"log/slog"
+	"pollingPlatform/health"
+	"pollingPlatform/metrics"
+	"pollingPlatform/repository"
+	"pollingPlatform/tracing"
+	"sync"
+	"time"
+)
+
+var (
+	metricRuns = metrics.Default.NewCounter("reconcile_runs_total",
+		"Reconciliation runs, including failed ones.")
+	metricFailures = metrics.Default.NewCounter("reconcile_failures_total",
+		"Reconciliation runs that failed.")
+	metricDrifted = metrics.Default.NewGauge("reconcile_drifted_options",
+		"Options whose counter differed from their ballots after the last full run.")
+	metricMismatched = metrics.Default.NewGauge("reconcile_mismatched_votes",
+		"Ballots pointing at an option of another poll, as of the last full run.")
+	metricRepaired = metrics.Default.NewCounter("reconcile_repaired_options_total",
+		"Option counters reset to their ballot count.")
+	metricLastRun = metrics.Default.NewGauge("reconcile_last_run_timestamp_seconds",
+		"Unix time the last reconciliation run finished.")
+	metricLastRunDuration = metrics.Default.NewGauge("reconcile_last_run_duration_seconds",
+		"Run time of the last reconciliation run.")
+)
+
+// Report is the outcome of one reconciliation run
+type Report struct {
+	StartedAt       time.Time                 `json:"startedAt"`
+	FinishedAt      time.Time                 `json:"finishedAt"`
+	PollID          uint                      `json:"pollId,omitempty"`
+	Repair          bool                      `json:"repair"`
+	Drift           []repository.CounterDrift `json:"drift"`
+	MismatchedVotes int64                     `json:"mismatchedVotes"`
+	RepairedOptions int                       `json:"repairedOptions"`
+	// Error is set when the run failed. Reports are served to admins over HTTP, so
+	// it is generic; Run returns the cause for the caller to log.
+	Error string `json:"error,omitempty"`
+}
+
+// Consistent reports whether the run found nothing wrong
+func (r *Report) Consistent() bool {
+	return r.Error == "" && len(r.Drift) == 0 && r.MismatchedVotes == 0
+}
+
+type Reconciler struct {
+	polls repository.PollStore
+
+	// run serializes reconciliation; mu guards last
+	run  sync.Mutex
+	mu   sync.RWMutex
+	last *Report
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewReconciler(polls repository.PollStore) *Reconciler {
+	return &Reconciler{polls: polls}
+}
+
+// Run compares counters to ballots for one poll, or all polls when pollID is 0.
+// With repair set, drifted counters are reset to their ballot count.
+func (r *Reconciler) Run(ctx context.Context, pollID uint, repair bool) (*Report, error) {
+	r.run.Lock()
+	defer r.run.Unlock()
+
+	report := &Report{StartedAt: time.Now(), PollID: pollID, Repair: repair}
+	err := r.check(r.polls.WithContext(ctx), report)
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = "reconciliation failed"
+		metricFailures.Inc()
+	}
+
+	metricRuns.Inc()
+	metricLastRun.Set(float64(report.FinishedAt.Unix()))
+	metricLastRunDuration.Set(report.FinishedAt.Sub(report.StartedAt).Seconds())
+	if pollID == 0 && err == nil {
+		// Gauges describe the whole database, so single-poll runs don't update them
+		metricDrifted.Set(float64(len(report.Drift) - report.RepairedOptions))
+		metricMismatched.Set(float64(report.MismatchedVotes))
+	}
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+	return report, err
+}
+
+func (r *Reconciler) check(polls repository.PollStore, report *Report) error {
+	drift, err := polls.FindCounterDrift(report.PollID)
+	if err != nil {
+		return err
+	}
+	if drift == nil {
+		drift = []repository.CounterDrift{}
+	}
+	report.Drift = drift
+
+	report.MismatchedVotes, err = polls.CountMismatchedVotes(report.PollID)
+	if err != nil {
+		return err
+	}
+
+	if !report.Repair {
+		return nil
+	}
+	for _, d := range drift {
+		if _, err := polls.RepairOptionCounter(d.OptionID); err != nil {
+			return err
+		}
+		report.RepairedOptions++
+		metricRepaired.Inc()
+	}
+	return nil
+}
+
+// Last returns the most recent report, or nil if nothing has run yet
+func (r *Reconciler) Last() *Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.last
+}
+
+// Start reconciles all polls periodically, logging any drift found
+func (r *Reconciler) Start(interval time.Duration, repair bool) {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				var report *Report
+				start := time.Now()
+				err := tracing.RunJob("reconcile", func(ctx context.Context) (err error) {
+					report, err = r.Run(ctx, 0, repair)
+					return err
+				})
+				metrics.RecordJob("reconcile", start, err)
+				health.RecordJob("reconcile", err)
+				if err != nil {
+					slog.Warn("vote reconciliation failed", "error", err)
+					continue
+				}
+				if !report.Consistent() {
+					slog.Warn("vote reconciliation found inconsistencies",
+						"drifted_options", len(report.Drift), "repaired_options", report.RepairedOptions, "mismatched_votes", report.MismatchedVotes)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *Reconciler) Stop() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	r.stop = nil
+}
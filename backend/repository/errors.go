@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPollNotFound    = errors.New("poll not found")
+	ErrPollClosed      = errors.New("poll has ended")
+	ErrOptionNotInPoll = errors.New("option does not belong to poll")
+	ErrAlreadyVoted    = errors.New("user has already voted on this poll")
+	// ErrVersionConflict means the record changed since the caller read it
+	ErrVersionConflict = errors.New("record was modified concurrently")
+)
+
+// pgUniqueViolation is the Postgres SQLSTATE for unique constraint violations
+const pgUniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolation
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// translateError maps constraint violations on the votes table to typed errors
+func translateError(err error) error {
+	if isUniqueViolation(err) {
+		return ErrAlreadyVoted
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"pollingPlatform/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// WithContext returns a repository whose queries run under ctx
+func (r *IdempotencyRepository) WithContext(ctx context.Context) *IdempotencyRepository {
+	return &IdempotencyRepository{db: r.db.WithContext(ctx)}
+}
+
+// Reserve claims (userID, key) for a new request. If the key is already taken the
+// existing record is returned with reserved=false. Expired records are replaced, and so
+// are reservations still pending after lease, whose request must have died with its
+// process.
+func (r *IdempotencyRepository) Reserve(record *models.IdempotencyRecord, lease time.Duration) (existing *models.IdempotencyRecord, reserved bool, err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil, true, nil
+		}
+
+		var found models.IdempotencyRecord
+		err := r.db.Where("user_id = ? AND key = ?", record.UserID, record.Key).Limit(1).Find(&found).Error
+		if err != nil {
+			return nil, false, err
+		}
+		now := time.Now()
+		abandoned := found.StatusCode == 0 && now.Sub(found.UpdatedAt) >= lease
+		if found.ID != 0 && now.Before(found.ExpiresAt) && !abandoned {
+			return &found, false, nil
+		}
+
+		// The old record expired, was abandoned or vanished; remove it and try again
+		if found.ID != 0 {
+			err := r.db.Where("id = ? AND (expires_at <= ? OR (status_code = 0 AND updated_at <= ?))", found.ID, now, now.Add(-lease)).
+				Delete(&models.IdempotencyRecord{}).Error
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		record.ID = 0
+	}
+	return nil, false, gorm.ErrDuplicatedKey
+}
+
+// Renew extends a pending reservation's lease
+func (r *IdempotencyRepository) Renew(id uint) error {
+	return r.db.Model(&models.IdempotencyRecord{}).Where("id = ? AND status_code = 0", id).
+		UpdateColumn("updated_at", time.Now()).Error
+}
+
+// Complete stores the response of a reserved request
+func (r *IdempotencyRepository) Complete(id uint, status int, contentType string, body []byte) error {
+	return r.db.Model(&models.IdempotencyRecord{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status_code":   status,
+		"content_type":  contentType,
+		"response_body": body,
+	}).Error
+}
+
+// Release drops a reservation so the request can be retried
+func (r *IdempotencyRepository) Release(id uint) error {
+	return r.db.Delete(&models.IdempotencyRecord{}, id).Error
+}
+
+func (r *IdempotencyRepository) DeleteExpired() error {
+	return r.db.Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyRecord{}).Error
+}
@@ -0,0 +1,20 @@
+package memstore_test
+
+import (
+	"pollingPlatform/repository"
+	"pollingPlatform/repository/memstore"
+	"pollingPlatform/repository/storetest"
+	"testing"
+)
+
+func TestPollStore(t *testing.T) {
+	storetest.RunPollStoreTests(t, func(t *testing.T) repository.PollStore {
+		return memstore.NewPollStore()
+	})
+}
+
+func TestUserStore(t *testing.T) {
+	storetest.RunUserStoreTests(t, func(t *testing.T) repository.UserStore {
+		return memstore.NewUserStore()
+	})
+}
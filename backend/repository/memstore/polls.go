@@ -0,0 +1,335 @@
+// Package memstore implements the repository stores in memory, for tests and for
+// running handlers without a database.
+package memstore
+
+import (
+	"context"
+	"pollingPlatform/models"
+	"pollingPlatform/repository"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type voteKey struct {
+	pollID, userID uint
+}
+
+// PollStore is a thread-safe in-memory repository.PollStore
+type PollStore struct {
+	mu           sync.RWMutex
+	polls        map[uint]*models.Poll
+	optionPoll   map[uint]uint // option ID -> poll ID
+	votes        map[voteKey]models.Vote
+	nextPollID   uint
+	nextOptionID uint
+	nextVoteID   uint
+}
+
+var _ repository.PollStore = (*PollStore)(nil)
+
+func NewPollStore() *PollStore {
+	return &PollStore{
+		polls:      make(map[uint]*models.Poll),
+		optionPoll: make(map[uint]uint),
+		votes:      make(map[voteKey]models.Vote),
+	}
+}
+
+// WithContext returns s; nothing here blocks or is traced
+func (s *PollStore) WithContext(context.Context) repository.PollStore {
+	return s
+}
+
+func (s *PollStore) CreatePoll(poll *models.Poll) error {
+	return s.CreatePollWithin(poll, nil)
+}
+
+func (s *PollStore) CreatePollWithin(poll *models.Poll, check repository.UsageCheck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if check != nil {
+		if err := check(s.countActivePolls(poll.UserID)); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	s.nextPollID++
+	poll.ID = s.nextPollID
+	poll.CreatedAt = now
+	poll.UpdatedAt = now
+	poll.Version = 1
+	for i := range poll.Options {
+		s.nextOptionID++
+		poll.Options[i].ID = s.nextOptionID
+		poll.Options[i].PollID = poll.ID
+		poll.Options[i].CreatedAt = now
+		poll.Options[i].UpdatedAt = now
+		s.optionPoll[poll.Options[i].ID] = poll.ID
+	}
+
+	s.polls[poll.ID] = clonePoll(poll)
+	return nil
+}
+
+func (s *PollStore) GetPollByID(id uint) (*models.Poll, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	poll, ok := s.polls[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return clonePoll(poll), nil
+}
+
+func (s *PollStore) GetPollByIDUncached(id uint) (*models.Poll, error) {
+	return s.GetPollByID(id)
+}
+
+func (s *PollStore) ListPolls(offset, limit int, status string) ([]models.Poll, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var matched []*models.Poll
+	for _, poll := range s.polls {
+		switch status {
+		case "active":
+			if !poll.EndDate.After(now) {
+				continue
+			}
+		case "ended":
+			if poll.EndDate.After(now) {
+				continue
+			}
+		}
+		matched = append(matched, poll)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.After(matched[j].CreatedAt)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+
+	total := int64(len(matched))
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	matched = matched[offset:]
+	if limit >= 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+
+	polls := make([]models.Poll, len(matched))
+	for i, poll := range matched {
+		polls[i] = *clonePoll(poll)
+	}
+	return polls, total, nil
+}
+
+func (s *PollStore) UpdatePollDetails(poll *models.Poll) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.polls[poll.ID]
+	if !ok {
+		return repository.ErrPollNotFound
+	}
+	if stored.Version != poll.Version {
+		return repository.ErrVersionConflict
+	}
+
+	stored.Title = poll.Title
+	stored.Description = poll.Description
+	stored.EndDate = poll.EndDate
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	poll.Version++
+	return nil
+}
+
+func (s *PollStore) SetHighTraffic(pollID uint, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.polls[pollID]
+	if !ok {
+		return repository.ErrPollNotFound
+	}
+	// Counts are exact in memory, so there are no shards to fold
+	if stored.HighTraffic != enabled {
+		stored.HighTraffic = enabled
+		stored.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *PollStore) CastVote(pollID, optionID, userID uint) (*models.Vote, error) {
+	return s.CastVoteWithin(pollID, optionID, userID, time.Time{}, nil)
+}
+
+func (s *PollStore) CastVoteWithin(pollID, optionID, userID uint, since time.Time, check repository.UsageCheck) (*models.Vote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if check != nil {
+		if err := check(s.countVotesSince(userID, since)); err != nil {
+			return nil, err
+		}
+	}
+
+	poll, ok := s.polls[pollID]
+	if !ok {
+		return nil, repository.ErrPollNotFound
+	}
+	if !poll.IsActive() {
+		return nil, repository.ErrPollClosed
+	}
+	option := findOption(poll, optionID)
+	if option == nil {
+		return nil, repository.ErrOptionNotInPoll
+	}
+	key := voteKey{pollID: pollID, userID: userID}
+	if _, voted := s.votes[key]; voted {
+		return nil, repository.ErrAlreadyVoted
+	}
+
+	now := time.Now()
+	s.nextVoteID++
+	vote := models.Vote{PollID: pollID, OptionID: optionID, UserID: userID}
+	vote.ID = s.nextVoteID
+	vote.CreatedAt = now
+	vote.UpdatedAt = now
+	s.votes[key] = vote
+
+	option.Votes++
+	option.UpdatedAt = now
+	return &vote, nil
+}
+
+func (s *PollStore) HasUserVoted(pollID uint, userID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, voted := s.votes[voteKey{pollID: pollID, userID: userID}]
+	return voted, nil
+}
+
+func (s *PollStore) CountActivePollsByUser(userID uint) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.countActivePolls(userID), nil
+}
+
+func (s *PollStore) CountVotesByUserSince(userID uint, since time.Time) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.countVotesSince(userID, since), nil
+}
+
+// countActivePolls and countVotesSince must be called with mu held
+func (s *PollStore) countActivePolls(userID uint) int64 {
+	now := time.Now()
+	var count int64
+	for _, poll := range s.polls {
+		if poll.UserID == userID && poll.EndDate.After(now) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *PollStore) countVotesSince(userID uint, since time.Time) int64 {
+	var count int64
+	for key, vote := range s.votes {
+		if key.userID == userID && !vote.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *PollStore) FindCounterDrift(pollID uint) ([]repository.CounterDrift, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ballots := s.ballotsByOption()
+	var drift []repository.CounterDrift
+	for _, poll := range s.polls {
+		if pollID != 0 && poll.ID != pollID {
+			continue
+		}
+		for _, o := range poll.Options {
+			if o.Votes != ballots[o.ID] {
+				drift = append(drift, repository.CounterDrift{PollID: poll.ID, OptionID: o.ID, Counter: o.Votes, Ballots: ballots[o.ID]})
+			}
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].PollID != drift[j].PollID {
+			return drift[i].PollID < drift[j].PollID
+		}
+		return drift[i].OptionID < drift[j].OptionID
+	})
+	return drift, nil
+}
+
+func (s *PollStore) CountMismatchedVotes(pollID uint) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for key, vote := range s.votes {
+		if pollID != 0 && key.pollID != pollID {
+			continue
+		}
+		if s.optionPoll[vote.OptionID] != key.pollID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *PollStore) RepairOptionCounter(optionID uint) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	poll, ok := s.polls[s.optionPoll[optionID]]
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+	option := findOption(poll, optionID)
+	ballots := s.ballotsByOption()[optionID]
+	option.Votes = ballots
+	option.UpdatedAt = time.Now()
+	return ballots, nil
+}
+
+// ballotsByOption counts votes per option; callers hold the lock
+func (s *PollStore) ballotsByOption() map[uint]int {
+	ballots := make(map[uint]int)
+	for _, vote := range s.votes {
+		ballots[vote.OptionID]++
+	}
+	return ballots
+}
+
+func findOption(poll *models.Poll, optionID uint) *models.Option {
+	for i := range poll.Options {
+		if poll.Options[i].ID == optionID {
+			return &poll.Options[i]
+		}
+	}
+	return nil
+}
+
+func clonePoll(poll *models.Poll) *models.Poll {
+	clone := *poll
+	clone.Options = append([]models.Option(nil), poll.Options...)
+	return &clone
+}
@@ -0,0 +1,156 @@
+package memstore
+
+import (
+	"context"
+	"pollingPlatform/models"
+	"pollingPlatform/quota"
+	"pollingPlatform/repository"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserStore is a thread-safe in-memory repository.UserStore
+type UserStore struct {
+	mu     sync.RWMutex
+	users  map[uint]*models.User
+	nextID uint
+}
+
+var _ repository.UserStore = (*UserStore)(nil)
+
+func NewUserStore() *UserStore {
+	return &UserStore{users: make(map[uint]*models.User)}
+}
+
+// WithContext returns s; nothing here blocks or is traced
+func (s *UserStore) WithContext(context.Context) repository.UserStore {
+	return s
+}
+
+func (s *UserStore) CreateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.identityTaken(user) {
+		return gorm.ErrDuplicatedKey
+	}
+
+	now := time.Now()
+	s.nextID++
+	user.ID = s.nextID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.Version = 1
+	if user.Plan == "" {
+		// Matches the column default
+		user.Plan = quota.DefaultPlan
+	}
+
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *UserStore) GetUserByID(id uint) (*models.User, error) {
+	return s.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (s *UserStore) GetUserByUsername(username string) (*models.User, error) {
+	return s.find(func(u *models.User) bool { return u.Username == username })
+}
+
+func (s *UserStore) GetUserByEmail(email string) (*models.User, error) {
+	return s.find(func(u *models.User) bool { return u.Email == email })
+}
+
+func (s *UserStore) GetUserByOIDCIdentity(issuer, subject string) (*models.User, error) {
+	return s.find(func(u *models.User) bool { return u.OIDCIssuer == issuer && u.OIDCSubject == subject })
+}
+
+// find returns a copy of the matching user with the lowest ID, like First does
+func (s *UserStore) find(match func(u *models.User) bool) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *models.User
+	for _, u := range s.users {
+		if match(u) && (found == nil || u.ID < found.ID) {
+			found = u
+		}
+	}
+	if found == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	user := *found
+	return &user, nil
+}
+
+func (s *UserStore) UpdateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return repository.ErrVersionConflict
+	}
+	if s.identityTaken(user) {
+		return gorm.ErrDuplicatedKey
+	}
+
+	user.Version++
+	user.UpdatedAt = time.Now()
+	updated := *user
+	updated.CreatedAt = stored.CreatedAt
+	s.users[user.ID] = &updated
+	return nil
+}
+
+// identityTaken reports whether another user is linked to user's OIDC identity,
+// like the unique index does
+func (s *UserStore) identityTaken(user *models.User) bool {
+	if user.OIDCSubject == "" {
+		return false
+	}
+	for _, u := range s.users {
+		if u.ID != user.ID && u.OIDCIssuer == user.OIDCIssuer && u.OIDCSubject == user.OIDCSubject {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *UserStore) UpdateRole(userID uint, role string, version uint) error {
+	return s.updateAtVersion(userID, version, func(u *models.User) { u.Role = role })
+}
+
+func (s *UserStore) UpdatePlan(userID uint, plan string, version uint) error {
+	return s.updateAtVersion(userID, version, func(u *models.User) { u.Plan = plan })
+}
+
+func (s *UserStore) UpdateRefreshToken(userID uint, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Like an UPDATE matching no rows, a missing user is not an error
+	if u, ok := s.users[userID]; ok {
+		u.RefreshToken = token
+		u.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// updateAtVersion changes a stored user that is still at version and bumps it
+func (s *UserStore) updateAtVersion(userID, version uint, change func(u *models.User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.Version != version {
+		return repository.ErrVersionConflict
+	}
+	change(u)
+	u.UpdatedAt = time.Now()
+	u.Version++
+	return nil
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"pollingPlatform/models"
+
+	"gorm.io/gorm"
+)
+
+type PlanRepository struct {
+	db *gorm.DB
+}
+
+func NewPlanRepository(db *gorm.DB) *PlanRepository {
+	return &PlanRepository{db: db}
+}
+
+func (r *PlanRepository) ListPlans() ([]models.Plan, error) {
+	var plans []models.Plan
+	err := r.db.Order("name").Find(&plans).Error
+	return plans, err
+}
+
+func (r *PlanRepository) GetPlanByName(name string) (*models.Plan, error) {
+	var plan models.Plan
+	err := r.db.Where("name = ?", name).First(&plan).Error
+	return &plan, err
+}
+
+// EnsurePlan creates the plan if no plan with that name exists
+func (r *PlanRepository) EnsurePlan(plan *models.Plan) error {
+	return r.db.Where(models.Plan{Name: plan.Name}).FirstOrCreate(plan).Error
+}
+
+func (r *PlanRepository) CreatePlan(plan *models.Plan) error {
+	return r.db.Create(plan).Error
+}
+
+func (r *PlanRepository) UpdatePlan(plan *models.Plan) error {
+	return r.db.Save(plan).Error
+}
@@ -1,31 +1,200 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"pollingPlatform/cache"
+	"pollingPlatform/metrics"
 	"pollingPlatform/models"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// voteShards is how many counter rows each option of a high-traffic poll spreads
+// its votes over
+const voteShards = 16
+
+// How long cached reads may be served. Ended polls only change through admin repairs,
+// which invalidate them, so they can stay much longer.
+const (
+	activePollTTL = 10 * time.Second
+	endedPollTTL  = 10 * time.Minute
+	pollListTTL   = 10 * time.Second
+)
+
+// sharedLoadTimeout bounds a cache miss that other callers may be waiting on
+const sharedLoadTimeout = 10 * time.Second
+
+var votesRecorded = metrics.Default.NewCounterVec("votes_recorded_total",
+	"Votes recorded by poll type (standard or high_traffic).", "poll_type")
+
 type PollRepository struct {
 	db *gorm.DB
+	// ctx is the context db is bound to, nil for none
+	ctx context.Context
+
+	// nil unless EnableCache was called
+	polls *cache.LRU[uint, *models.Poll]
+	lists *cache.LRU[pollListKey, pollPage]
+}
+
+type pollListKey struct {
+	offset, limit int
+	status        string
+}
+
+type pollPage struct {
+	polls []models.Poll
+	total int64
 }
 
 func NewPollRepository(db *gorm.DB) *PollRepository {
 	return &PollRepository{db: db}
 }
 
+// WithContext returns a repository sharing this one's cache whose queries run under ctx
+func (r *PollRepository) WithContext(ctx context.Context) PollStore {
+	scoped := *r
+	scoped.db = r.db.WithContext(ctx)
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// shared returns a copy for cache loads that other callers wait on. It keeps the
+// caller's trace but not its cancellation, so a client that disconnects doesn't fail
+// the load for everyone else.
+func (r *PollRepository) shared() (*PollRepository, context.CancelFunc) {
+	ctx := context.Background()
+	if r.ctx != nil {
+		ctx = context.WithoutCancel(r.ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, sharedLoadTimeout)
+	scoped := *r
+	scoped.db = r.db.WithContext(ctx)
+	scoped.ctx = ctx
+	return &scoped, cancel
+}
+
+// EnableCache serves GetPollByID and ListPolls from an LRU cache holding up to
+// capacity entries each. Writes through this repository invalidate it, except that
+// listings show vote counts up to pollListTTL old; changes made by other instances
+// show up once the TTL runs out.
+func (r *PollRepository) EnableCache(capacity int) {
+	r.polls = cache.NewLRU[uint, *models.Poll](capacity)
+	r.lists = cache.NewLRU[pollListKey, pollPage](capacity)
+}
+
+// PollCacheStats reports the counters of the single poll cache; zero when caching
+// is disabled
+func (r *PollRepository) PollCacheStats() cache.Stats {
+	if r.polls == nil {
+		return cache.Stats{}
+	}
+	return r.polls.Stats()
+}
+
+// ListCacheStats reports the counters of the poll listing cache; zero when caching
+// is disabled
+func (r *PollRepository) ListCacheStats() cache.Stats {
+	if r.lists == nil {
+		return cache.Stats{}
+	}
+	return r.lists.Stats()
+}
+
 func (r *PollRepository) CreatePoll(poll *models.Poll) error {
-	return r.db.Create(poll).Error
+	return r.CreatePollWithin(poll, nil)
+}
+
+// CreatePollWithin locks the owner's user row before counting their active polls, so
+// concurrent creations by the same user are checked one after another
+func (r *PollRepository) CreatePollWithin(poll *models.Poll, check UsageCheck) error {
+	poll.Version = 1
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if check != nil {
+			if err := lockUser(tx, poll.UserID); err != nil {
+				return err
+			}
+			active, err := countActivePolls(tx, poll.UserID)
+			if err != nil {
+				return err
+			}
+			if err := check(active); err != nil {
+				return err
+			}
+		}
+		return tx.Create(poll).Error
+	})
+	if err != nil {
+		return err
+	}
+	r.invalidateLists()
+	return nil
 }
 
 func (r *PollRepository) GetPollByID(id uint) (*models.Poll, error) {
+	if r.polls == nil {
+		return r.loadPoll(id)
+	}
+
+	poll, err := r.polls.GetOrLoad(id, func() (*models.Poll, time.Duration, error) {
+		shared, cancel := r.shared()
+		defer cancel()
+		poll, err := shared.loadPoll(id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if poll.IsActive() {
+			return poll, activePollTTL, nil
+		}
+		return poll, endedPollTTL, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Callers get their own copy so they can't modify the cached one
+	return clonePoll(poll), nil
+}
+
+// GetPollByIDUncached reads the poll from the database even when caching is enabled,
+// for callers that must not act on a stale copy
+func (r *PollRepository) GetPollByIDUncached(id uint) (*models.Poll, error) {
+	return r.loadPoll(id)
+}
+
+func (r *PollRepository) loadPoll(id uint) (*models.Poll, error) {
 	var poll models.Poll
-	err := r.db.Preload("Options").First(&poll, id).Error
+	err := r.db.Preload("Options", optionsWithVotes).First(&poll, id).Error
 	return &poll, err
 }
 
 func (r *PollRepository) ListPolls(offset, limit int, status string) ([]models.Poll, int64, error) {
+	if r.lists == nil {
+		return r.loadPolls(offset, limit, status)
+	}
+
+	key := pollListKey{offset: offset, limit: limit, status: status}
+	page, err := r.lists.GetOrLoad(key, func() (pollPage, time.Duration, error) {
+		shared, cancel := r.shared()
+		defer cancel()
+		polls, total, err := shared.loadPolls(offset, limit, status)
+		return pollPage{polls: polls, total: total}, pollListTTL, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	polls := make([]models.Poll, len(page.polls))
+	for i := range page.polls {
+		polls[i] = *clonePoll(&page.polls[i])
+	}
+	return polls, page.total, nil
+}
+
+func (r *PollRepository) loadPolls(offset, limit int, status string) ([]models.Poll, int64, error) {
 	var polls []models.Poll
 	var total int64
 	query := r.db.Model(&models.Poll{})
@@ -46,7 +215,7 @@ func (r *PollRepository) ListPolls(offset, limit int, status string) ([]models.P
 
 	// Get paginated results
 	err := query.
-		Preload("Options").
+		Preload("Options", optionsWithVotes).
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(limit).
@@ -55,6 +224,41 @@ func (r *PollRepository) ListPolls(offset, limit int, status string) ([]models.P
 	return polls, total, err
 }
 
+// CountActivePollsByUser counts the user's polls that haven't ended
+func (r *PollRepository) CountActivePollsByUser(userID uint) (int64, error) {
+	return countActivePolls(r.db, userID)
+}
+
+// CountVotesByUserSince counts votes the user cast since the given time
+func (r *PollRepository) CountVotesByUserSince(userID uint, since time.Time) (int64, error) {
+	return countVotesSince(r.db, userID, since)
+}
+
+func countActivePolls(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.Poll{}).
+		Where("user_id = ? AND end_date > ?", userID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+func countVotesSince(db *gorm.DB, userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := db.Model(&models.Vote{}).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Count(&count).Error
+	return count, err
+}
+
+// lockUser takes the user's row lock for the rest of tx, which serializes quota
+// checks of the same user. SQLite ignores the clause but runs one write transaction
+// at a time anyway.
+func lockUser(tx *gorm.DB, userID uint) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").Where("id = ?", userID).Limit(1).
+		Find(&models.User{}).Error
+}
+
 func (r *PollRepository) HasUserVoted(pollID uint, userID uint) (bool, error) {
 	var count int64
 	err := r.db.Model(&models.Vote{}).
@@ -63,24 +267,263 @@ func (r *PollRepository) HasUserVoted(pollID uint, userID uint) (bool, error) {
 	return count > 0, err
 }
 
-func (r *PollRepository) RecordVote(pollID uint, optionID uint, userID uint) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+// CastVote records a vote and increments the option's counter in one transaction.
+// The poll row is share-locked so it can't be closed or edited mid-vote, and the
+// (poll_id, user_id) unique index decides concurrent double votes. High-traffic polls
+// increment a random shard row instead, so concurrent voters don't queue on one row.
+func (r *PollRepository) CastVote(pollID, optionID, userID uint) (*models.Vote, error) {
+	return r.CastVoteWithin(pollID, optionID, userID, time.Time{}, nil)
+}
+
+// CastVoteWithin is CastVote with a quota check. The voter's user row is locked before
+// their votes are counted, so concurrent votes by the same user are checked one after
+// another; voters on the same poll don't wait for each other.
+func (r *PollRepository) CastVoteWithin(pollID, optionID, userID uint, since time.Time, check UsageCheck) (*models.Vote, error) {
+	vote := models.Vote{
+		PollID:   pollID,
+		OptionID: optionID,
+		UserID:   userID,
+	}
 
-		vote := models.Vote{
-			PollID:   pollID,
-			OptionID: optionID,
-			UserID:   userID,
+	pollType := "standard"
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if check != nil {
+			if err := lockUser(tx, userID); err != nil {
+				return err
+			}
+			used, err := countVotesSince(tx, userID, since)
+			if err != nil {
+				return err
+			}
+			if err := check(used); err != nil {
+				return err
+			}
 		}
-		if err := tx.Create(&vote).Error; err != nil {
+
+		// Besides the voter's own row, the share lock on the poll is the only lock a
+		// vote takes before writing. It keeps SetHighTraffic and RepairOptionCounter,
+		// which lock the poll for update, from folding or recounting the counters
+		// between the ballot and its increment.
+		var poll models.Poll
+		err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&poll, pollID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPollNotFound
+		}
+		if err != nil {
 			return err
 		}
+		if !poll.IsActive() {
+			return ErrPollClosed
+		}
 
-		if err := tx.Model(&models.Option{}).
+		// Options are never deleted, so a plain read suffices; locking the option row
+		// would serialize every voter on a popular option again
+		var option models.Option
+		err = tx.Select("id").Where("id = ? AND poll_id = ?", optionID, pollID).First(&option).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOptionNotInPoll
+		}
+		if err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "poll_id"}, {Name: "user_id"}},
+			DoNothing: true,
+		}).Create(&vote)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyVoted
+		}
+
+		if poll.HighTraffic {
+			pollType = "high_traffic"
+			return tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "option_id"}, {Name: "shard"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"votes": gorm.Expr("option_vote_shards.votes + 1")}),
+			}).Create(&models.OptionVoteShard{OptionID: optionID, Shard: rand.IntN(voteShards), Votes: 1}).Error
+		}
+		return tx.Model(&models.Option{}).
 			Where("id = ?", optionID).
-			Update("votes", gorm.Expr("votes + ?", 1)).Error; err != nil {
+			Update("votes", gorm.Expr("votes + ?", 1)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	votesRecorded.WithLabelValues(pollType).Inc()
+	r.invalidate(pollID)
+	return &vote, nil
+}
+
+// UpdatePollDetails saves an edited title, description and end date. poll.Version must
+// be the version the edit was based on; it is bumped on success and ErrVersionConflict
+// is returned if someone else saved in between.
+func (r *PollRepository) UpdatePollDetails(poll *models.Poll) error {
+	result := r.db.Model(&models.Poll{}).
+		Where("id = ? AND version = ?", poll.ID, poll.Version).
+		Updates(map[string]interface{}{
+			"title":       poll.Title,
+			"description": poll.Description,
+			"end_date":    poll.EndDate,
+			"version":     gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := r.db.Model(&models.Poll{}).Where("id = ?", poll.ID).Count(&count).Error; err != nil {
 			return err
 		}
+		if count == 0 {
+			return ErrPollNotFound
+		}
+		return ErrVersionConflict
+	}
+
+	poll.Version++
+	r.invalidate(poll.ID)
+	// A new end date can move the poll between the active and ended listings
+	r.invalidateLists()
+	return nil
+}
+
+// SetHighTraffic turns sharded vote counting on or off for a poll. Turning it off
+// folds the shards back into the option counters.
+func (r *PollRepository) SetHighTraffic(pollID uint, enabled bool) error {
+	defer r.invalidate(pollID)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the poll waits out in-flight votes, which hold a share lock on it
+		var poll models.Poll
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&poll, pollID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPollNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if poll.HighTraffic == enabled {
+			return nil
+		}
+
+		if err := tx.Model(&poll).Update("high_traffic", enabled).Error; err != nil {
+			return err
+		}
+		if enabled {
+			return nil
+		}
 
-		return nil
+		if err := tx.Exec(`UPDATE options SET votes = votes + COALESCE(
+			(SELECT SUM(s.votes) FROM option_vote_shards AS s WHERE s.option_id = options.id), 0)
+			WHERE poll_id = ?`, pollID).Error; err != nil {
+			return err
+		}
+		return tx.Where("option_id IN (?)", tx.Model(&models.Option{}).Select("id").Where("poll_id = ?", pollID)).
+			Delete(&models.OptionVoteShard{}).Error
 	})
 }
+
+// optionsWithVotes loads options in creation order, so option indexes are stable, with
+// sharded votes added to Votes. Being one statement, the total comes from one snapshot.
+func optionsWithVotes(db *gorm.DB) *gorm.DB {
+	return db.Select("options.id, options.created_at, options.updated_at, options.deleted_at, options.poll_id, options.text, " +
+		"options.votes + COALESCE((SELECT SUM(s.votes) FROM option_vote_shards AS s WHERE s.option_id = options.id), 0) AS votes").
+		Order("options.id")
+}
+
+// CounterDrift is an option whose denormalized vote counter disagrees with its ballots
+type CounterDrift struct {
+	PollID   uint `json:"pollId"`
+	OptionID uint `json:"optionId"`
+	Counter  int  `json:"counter"`
+	Ballots  int  `json:"ballots"`
+}
+
+// FindCounterDrift compares every option's vote counter to its vote rows.
+// A pollID of 0 checks all polls.
+func (r *PollRepository) FindCounterDrift(pollID uint) ([]CounterDrift, error) {
+	query := r.db.Table("options AS o").
+		Select("o.poll_id, o.id AS option_id, o.votes + COALESCE(s.votes, 0) AS counter, COUNT(v.id) AS ballots").
+		Joins("LEFT JOIN (SELECT option_id, SUM(votes) AS votes FROM option_vote_shards GROUP BY option_id) AS s ON s.option_id = o.id").
+		Joins("LEFT JOIN votes AS v ON v.option_id = o.id AND v.deleted_at IS NULL").
+		Where("o.deleted_at IS NULL").
+		Group("o.poll_id, o.id, o.votes, s.votes").
+		Having("o.votes + COALESCE(s.votes, 0) <> COUNT(v.id)").
+		Order("o.poll_id, o.id")
+	if pollID != 0 {
+		query = query.Where("o.poll_id = ?", pollID)
+	}
+
+	var drift []CounterDrift
+	err := query.Scan(&drift).Error
+	return drift, err
+}
+
+// CountMismatchedVotes counts votes pointing at an option that doesn't belong to
+// the vote's poll. These can't be repaired automatically.
+func (r *PollRepository) CountMismatchedVotes(pollID uint) (int64, error) {
+	query := r.db.Table("votes AS v").
+		Joins("LEFT JOIN options AS o ON o.id = v.option_id AND o.poll_id = v.poll_id AND o.deleted_at IS NULL").
+		Where("v.deleted_at IS NULL AND o.id IS NULL")
+	if pollID != 0 {
+		query = query.Where("v.poll_id = ?", pollID)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// RepairOptionCounter resets an option's counter to its number of ballots and clears its
+// shards. The poll is locked before counting so votes cast concurrently are not lost.
+func (r *PollRepository) RepairOptionCounter(optionID uint) (int, error) {
+	var ballots int64
+	var option models.Option
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&option, optionID).Error; err != nil {
+			return err
+		}
+		// Locking the poll waits out in-flight votes, which hold a share lock on it, so
+		// the ballot count and the counters it replaces match
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Poll{}, option.PollID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Vote{}).Where("option_id = ?", optionID).Count(&ballots).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("option_id = ?", optionID).Delete(&models.OptionVoteShard{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&option).Update("votes", ballots).Error
+	})
+	if option.PollID != 0 {
+		r.invalidate(option.PollID)
+	}
+	return int(ballots), err
+}
+
+// invalidate drops a changed poll. Listings that include it keep showing the old
+// vote counts until pollListTTL runs out, so votes don't empty the listing cache.
+func (r *PollRepository) invalidate(pollID uint) {
+	if r.polls == nil {
+		return
+	}
+	r.polls.Delete(pollID)
+}
+
+// invalidateLists drops every cached listing, for changes to which polls they hold
+// or what they show besides vote counts
+func (r *PollRepository) invalidateLists() {
+	if r.lists == nil {
+		return
+	}
+	r.lists.Purge()
+}
+
+func clonePoll(poll *models.Poll) *models.Poll {
+	clone := *poll
+	clone.Options = append([]models.Option(nil), poll.Options...)
+	return &clone
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"pollingPlatform/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RateLimitRepository struct {
+	db *gorm.DB
+}
+
+func NewRateLimitRepository(db *gorm.DB) *RateLimitRepository {
+	return &RateLimitRepository{db: db}
+}
+
+// WithContext returns a repository whose queries run under ctx
+func (r *RateLimitRepository) WithContext(ctx context.Context) *RateLimitRepository {
+	return &RateLimitRepository{db: r.db.WithContext(ctx)}
+}
+
+// SlidingWindowHit counts a request in the current window and returns the counts of the
+// current and previous windows. When the weighted total would exceed limit the hit is
+// undone and allowed is false. The upsert row lock serializes concurrent hits per key.
+func (r *RateLimitRepository) SlidingWindowHit(key string, now time.Time, window time.Duration, limit int) (current, previous int, allowed bool, err error) {
+	windowStart := now.Truncate(window)
+	elapsed := float64(now.Sub(windowStart)) / float64(window)
+
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw(`INSERT INTO rate_limit_counters (key, window_start, count) VALUES (?, ?, 1)
+			ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limit_counters.count + 1
+			RETURNING count`, key, windowStart).Scan(&current).Error; err != nil {
+			return err
+		}
+
+		var prev models.RateLimitCounter
+		result := tx.Where("key = ? AND window_start = ?", key, windowStart.Add(-window)).Limit(1).Find(&prev)
+		if result.Error != nil {
+			return result.Error
+		}
+		previous = prev.Count
+
+		estimate := float64(previous)*(1-elapsed) + float64(current)
+		allowed = estimate <= float64(limit)
+		if !allowed {
+			// Rejected requests don't consume quota
+			current--
+			return tx.Model(&models.RateLimitCounter{}).
+				Where("key = ? AND window_start = ?", key, windowStart).
+				Update("count", gorm.Expr("count - 1")).Error
+		}
+		return nil
+	})
+	return current, previous, allowed, err
+}
+
+// DeleteCountersBefore removes windows that can no longer affect any decision
+func (r *RateLimitRepository) DeleteCountersBefore(t time.Time) error {
+	return r.db.Where("window_start < ?", t).Delete(&models.RateLimitCounter{}).Error
+}
@@ -0,0 +1,27 @@
+package repository_test
+
+import (
+	"pollingPlatform/repository"
+	"pollingPlatform/repository/storetest"
+	"testing"
+)
+
+func TestPollRepository(t *testing.T) {
+	storetest.RunPollStoreTests(t, func(t *testing.T) repository.PollStore {
+		return repository.NewPollRepository(storetest.OpenSQLite(t))
+	})
+}
+
+func TestCachedPollRepository(t *testing.T) {
+	storetest.RunPollStoreTests(t, func(t *testing.T) repository.PollStore {
+		repo := repository.NewPollRepository(storetest.OpenSQLite(t))
+		repo.EnableCache(100)
+		return repo
+	})
+}
+
+func TestUserRepository(t *testing.T) {
+	storetest.RunUserStoreTests(t, func(t *testing.T) repository.UserStore {
+		return repository.NewUserRepository(storetest.OpenSQLite(t))
+	})
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"pollingPlatform/models"
+
+	"gorm.io/gorm"
+)
+
+type RoleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// WithContext returns a repository whose queries run under ctx
+func (r *RoleRepository) WithContext(ctx context.Context) *RoleRepository {
+	return &RoleRepository{db: r.db.WithContext(ctx)}
+}
+
+func (r *RoleRepository) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *RoleRepository) GetRoleByName(name string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.Preload("Permissions").Where("name = ?", name).First(&role).Error
+	return &role, err
+}
+
+func (r *RoleRepository) ListPermissions() ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := r.db.Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+// EnsurePermission creates the permission if it doesn't exist
+func (r *RoleRepository) EnsurePermission(name, description string) error {
+	permission := models.Permission{Name: name, Description: description}
+	return r.db.Where(models.Permission{Name: name}).FirstOrCreate(&permission).Error
+}
+
+// CreateRole creates a role granting the named permissions
+func (r *RoleRepository) CreateRole(role *models.Role, permissionNames []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var permissions []models.Permission
+		if len(permissionNames) > 0 {
+			if err := tx.Where("name IN ?", permissionNames).Find(&permissions).Error; err != nil {
+				return err
+			}
+		}
+		role.Permissions = permissions
+		return tx.Create(role).Error
+	})
+}
+
+// SetRolePermissions replaces the permissions granted by a role
+func (r *RoleRepository) SetRolePermissions(role *models.Role, permissionNames []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var permissions []models.Permission
+		if len(permissionNames) > 0 {
+			if err := tx.Where("name IN ?", permissionNames).Find(&permissions).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(role).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+		role.Permissions = permissions
+		return nil
+	})
+}
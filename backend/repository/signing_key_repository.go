@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"pollingPlatform/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SigningKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyRepository(db *gorm.DB) *SigningKeyRepository {
+	return &SigningKeyRepository{db: db}
+}
+
+// WithContext returns a repository whose queries run under ctx
+func (r *SigningKeyRepository) WithContext(ctx context.Context) *SigningKeyRepository {
+	return &SigningKeyRepository{db: r.db.WithContext(ctx)}
+}
+
+func (r *SigningKeyRepository) CreateKey(key *models.SigningKey) error {
+	return r.db.Create(key).Error
+}
+
+// ListActiveKeys returns keys that have not retired yet, newest first
+func (r *SigningKeyRepository) ListActiveKeys() ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := r.db.Where("retires_at > ?", time.Now()).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *SigningKeyRepository) DeleteRetiredKeys() error {
+	return r.db.Unscoped().Where("retires_at <= ?", time.Now()).Delete(&models.SigningKey{}).Error
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"pollingPlatform/models"
+	"time"
+)
+
+// PollStore persists polls, their options and votes. Lookups of missing polls fail
+// with gorm.ErrRecordNotFound; vote and edit failures use the errors in errors.go.
+// PollRepository is the GORM implementation; memstore has an in-memory one.
+type PollStore interface {
+	// WithContext returns a store whose queries run under ctx, so they are
+	// cancelled and traced with the request
+	WithContext(ctx context.Context) PollStore
+
+	CreatePoll(poll *models.Poll) error
+	// CreatePollWithin creates the poll if check accepts the number of active polls
+	// its owner already has
+	CreatePollWithin(poll *models.Poll, check UsageCheck) error
+	GetPollByID(id uint) (*models.Poll, error)
+	// GetPollByIDUncached bypasses any read cache
+	GetPollByIDUncached(id uint) (*models.Poll, error)
+	// ListPolls pages through polls newest first; status is "active", "ended" or anything else for all
+	ListPolls(offset, limit int, status string) ([]models.Poll, int64, error)
+	UpdatePollDetails(poll *models.Poll) error
+	SetHighTraffic(pollID uint, enabled bool) error
+
+	CastVote(pollID, optionID, userID uint) (*models.Vote, error)
+	// CastVoteWithin casts the vote if check accepts the number of votes the user
+	// cast since the given time
+	CastVoteWithin(pollID, optionID, userID uint, since time.Time, check UsageCheck) (*models.Vote, error)
+	HasUserVoted(pollID uint, userID uint) (bool, error)
+	CountActivePollsByUser(userID uint) (int64, error)
+	CountVotesByUserSince(userID uint, since time.Time) (int64, error)
+
+	FindCounterDrift(pollID uint) ([]CounterDrift, error)
+	CountMismatchedVotes(pollID uint) (int64, error)
+	RepairOptionCounter(optionID uint) (int, error)
+}
+
+// UsageCheck decides whether a user may use a quota once more given how much of it
+// they used so far. Stores run it in the same transaction as the write, with writes
+// by the same user serialized, so concurrent requests can't all pass on the same
+// count. A non-nil error aborts the write and is returned unchanged; a nil check
+// allows everything.
+type UsageCheck func(used int64) error
+
+// UserStore persists user accounts. Lookups of missing users fail with
+// gorm.ErrRecordNotFound. UserRepository is the GORM implementation.
+type UserStore interface {
+	WithContext(ctx context.Context) UserStore
+
+	CreateUser(user *models.User) error
+	GetUserByID(id uint) (*models.User, error)
+	GetUserByUsername(username string) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	GetUserByOIDCIdentity(issuer, subject string) (*models.User, error)
+	UpdateUser(user *models.User) error
+	// UpdateRole and UpdatePlan change the user only if they are still at version,
+	// failing with ErrVersionConflict otherwise
+	UpdateRole(userID uint, role string, version uint) error
+	UpdatePlan(userID uint, plan string, version uint) error
+	UpdateRefreshToken(userID uint, token string) error
+}
+
+var (
+	_ PollStore = (*PollRepository)(nil)
+	_ UserStore = (*UserRepository)(nil)
+)
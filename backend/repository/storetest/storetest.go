@@ -0,0 +1,622 @@
+// Package storetest is a conformance suite for repository.PollStore and
+// repository.UserStore implementations, so the GORM and in-memory stores behave alike.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pollingPlatform/migrations"
+	"pollingPlatform/models"
+	"pollingPlatform/repository"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// OpenSQLite returns a migrated, private in-memory SQLite database
+func OpenSQLite(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:?_pragma=foreign_keys(1)"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("opening sqlite: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("opening sqlite: %v", err)
+	}
+	// Every connection to :memory: is a separate database, so keep exactly one
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	migrator, err := migrations.New(sqlDB, migrations.SQLite)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return db
+}
+
+// NewPoll returns an unsaved poll ending after d with the given option texts
+func NewPoll(userID uint, d time.Duration, options ...string) *models.Poll {
+	poll := &models.Poll{
+		UserID:      userID,
+		Title:       "Poll",
+		Description: "Description",
+		EndDate:     time.Now().Add(d),
+	}
+	for _, text := range options {
+		poll.Options = append(poll.Options, models.Option{Text: text})
+	}
+	return poll
+}
+
+// RunPollStoreTests checks a PollStore. newStore must return an empty store.
+func RunPollStoreTests(t *testing.T, newStore func(t *testing.T) repository.PollStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(7, time.Hour, "a", "b", "c")
+		mustCreate(t, s, poll)
+		if poll.ID == 0 || poll.Version != 1 {
+			t.Fatalf("created poll has ID %d, version %d", poll.ID, poll.Version)
+		}
+
+		got, err := s.GetPollByID(poll.ID)
+		if err != nil {
+			t.Fatalf("GetPollByID: %v", err)
+		}
+		if got.UserID != 7 || got.Title != "Poll" || len(got.Options) != 3 {
+			t.Fatalf("got %+v", got)
+		}
+		for i, text := range []string{"a", "b", "c"} {
+			o := got.Options[i]
+			if o.Text != text || o.ID != poll.Options[i].ID || o.PollID != poll.ID || o.Votes != 0 {
+				t.Errorf("option %d = %+v", i, o)
+			}
+		}
+	})
+
+	t.Run("GetMissing", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.GetPollByID(404); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("err = %v, want gorm.ErrRecordNotFound", err)
+		}
+	})
+
+	t.Run("ReturnedPollsAreCopies", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(1, time.Hour, "a", "b")
+		mustCreate(t, s, poll)
+
+		got, _ := s.GetPollByID(poll.ID)
+		got.Title = "changed"
+		got.Options[0].Votes = 99
+
+		again, _ := s.GetPollByID(poll.ID)
+		if again.Title != "Poll" || again.Options[0].Votes != 0 {
+			t.Fatalf("store was modified through a returned poll: %+v", again)
+		}
+	})
+
+	t.Run("ListPolls", func(t *testing.T) {
+		s := newStore(t)
+		var ids []uint
+		for i := 0; i < 5; i++ {
+			d := time.Hour
+			if i%2 == 1 {
+				d = -time.Hour
+			}
+			poll := NewPoll(1, d, "a", "b")
+			mustCreate(t, s, poll)
+			ids = append(ids, poll.ID)
+			// Distinct creation times make newest-first ordering deterministic
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		polls, total, err := s.ListPolls(0, 2, "all")
+		if err != nil {
+			t.Fatalf("ListPolls: %v", err)
+		}
+		if total != 5 || len(polls) != 2 || polls[0].ID != ids[4] || polls[1].ID != ids[3] {
+			t.Fatalf("first page: total %d, polls %v", total, pollIDs(polls))
+		}
+		if len(polls[0].Options) != 2 {
+			t.Fatalf("listed poll has %d options, want 2", len(polls[0].Options))
+		}
+
+		polls, _, _ = s.ListPolls(4, 2, "all")
+		if len(polls) != 1 || polls[0].ID != ids[0] {
+			t.Fatalf("last page: %v", pollIDs(polls))
+		}
+
+		polls, total, _ = s.ListPolls(0, 10, "active")
+		if total != 3 || len(polls) != 3 {
+			t.Fatalf("active: total %d, polls %v", total, pollIDs(polls))
+		}
+		polls, total, _ = s.ListPolls(0, 10, "ended")
+		if total != 2 || len(polls) != 2 {
+			t.Fatalf("ended: total %d, polls %v", total, pollIDs(polls))
+		}
+	})
+
+	t.Run("CastVote", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(1, time.Hour, "a", "b")
+		mustCreate(t, s, poll)
+
+		vote, err := s.CastVote(poll.ID, poll.Options[1].ID, 42)
+		if err != nil {
+			t.Fatalf("CastVote: %v", err)
+		}
+		if vote.ID == 0 || vote.PollID != poll.ID || vote.OptionID != poll.Options[1].ID || vote.UserID != 42 {
+			t.Fatalf("vote = %+v", vote)
+		}
+		assertVotes(t, s, poll.ID, 0, 1)
+
+		voted, err := s.HasUserVoted(poll.ID, 42)
+		if err != nil || !voted {
+			t.Fatalf("HasUserVoted = %v, %v", voted, err)
+		}
+		voted, _ = s.HasUserVoted(poll.ID, 43)
+		if voted {
+			t.Fatal("HasUserVoted is true for a user who didn't vote")
+		}
+	})
+
+	t.Run("CastVoteErrors", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(1, time.Hour, "a", "b")
+		other := NewPoll(1, time.Hour, "x", "y")
+		ended := NewPoll(1, -time.Hour, "a", "b")
+		mustCreate(t, s, poll)
+		mustCreate(t, s, other)
+		mustCreate(t, s, ended)
+
+		if _, err := s.CastVote(poll.ID, poll.Options[0].ID, 1); err != nil {
+			t.Fatalf("CastVote: %v", err)
+		}
+
+		cases := []struct {
+			name             string
+			poll, option, by uint
+			want             error
+		}{
+			{"second vote", poll.ID, poll.Options[1].ID, 1, repository.ErrAlreadyVoted},
+			{"missing poll", 9999, poll.Options[0].ID, 2, repository.ErrPollNotFound},
+			{"option of other poll", poll.ID, other.Options[0].ID, 2, repository.ErrOptionNotInPoll},
+			{"ended poll", ended.ID, ended.Options[0].ID, 2, repository.ErrPollClosed},
+		}
+		for _, tc := range cases {
+			if _, err := s.CastVote(tc.poll, tc.option, tc.by); !errors.Is(err, tc.want) {
+				t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+			}
+		}
+		assertVotes(t, s, poll.ID, 1, 0)
+	})
+
+	t.Run("ConcurrentVotes", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(1, time.Hour, "a", "b")
+		mustCreate(t, s, poll)
+
+		const voters = 20
+		var wg sync.WaitGroup
+		errs := make(chan error, voters*2)
+		for i := 0; i < voters; i++ {
+			wg.Add(2)
+			// Every user votes twice at once; exactly one of each pair may succeed
+			for j := 0; j < 2; j++ {
+				go func(user uint) {
+					defer wg.Done()
+					if _, err := s.CastVote(poll.ID, poll.Options[0].ID, user); err != nil {
+						errs <- err
+					}
+				}(uint(100 + i))
+			}
+		}
+		wg.Wait()
+		close(errs)
+
+		rejected := 0
+		for err := range errs {
+			if !errors.Is(err, repository.ErrAlreadyVoted) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			rejected++
+		}
+		if rejected != voters {
+			t.Fatalf("%d duplicate votes rejected, want %d", rejected, voters)
+		}
+		assertVotes(t, s, poll.ID, voters, 0)
+	})
+
+	t.Run("Counts", func(t *testing.T) {
+		s := newStore(t)
+		active := NewPoll(5, time.Hour, "a", "b")
+		mustCreate(t, s, active)
+		mustCreate(t, s, NewPoll(5, time.Hour, "a", "b"))
+		mustCreate(t, s, NewPoll(5, -time.Hour, "a", "b"))
+		mustCreate(t, s, NewPoll(6, time.Hour, "a", "b"))
+
+		if n, err := s.CountActivePollsByUser(5); err != nil || n != 2 {
+			t.Fatalf("CountActivePollsByUser = %d, %v; want 2", n, err)
+		}
+
+		before := time.Now().Add(-time.Minute)
+		if _, err := s.CastVote(active.ID, active.Options[0].ID, 9); err != nil {
+			t.Fatalf("CastVote: %v", err)
+		}
+		if n, err := s.CountVotesByUserSince(9, before); err != nil || n != 1 {
+			t.Fatalf("CountVotesByUserSince = %d, %v; want 1", n, err)
+		}
+		if n, _ := s.CountVotesByUserSince(9, time.Now().Add(time.Minute)); n != 0 {
+			t.Fatalf("CountVotesByUserSince in the future = %d, want 0", n)
+		}
+	})
+
+	t.Run("ConcurrentQuotaChecks", func(t *testing.T) {
+		s := newStore(t)
+		errQuota := errors.New("quota exceeded")
+		limit := func(max int64) repository.UsageCheck {
+			return func(used int64) error {
+				// Widen the gap between count and write for a store that doesn't
+				// serialize them
+				time.Sleep(2 * time.Millisecond)
+				if used >= max {
+					return errQuota
+				}
+				return nil
+			}
+		}
+
+		// Parallel writes by one user must each see the ones before them, so no more
+		// than the limit succeed
+		const attempts, max = 12, 3
+		polls := make([]*models.Poll, attempts)
+		var created, voted atomic.Int64
+		var wg sync.WaitGroup
+		for i := range polls {
+			polls[i] = NewPoll(5, time.Hour, "a", "b")
+			wg.Add(1)
+			go func(poll *models.Poll) {
+				defer wg.Done()
+				err := s.CreatePollWithin(poll, limit(max))
+				if err == nil {
+					created.Add(1)
+				} else if !errors.Is(err, errQuota) {
+					t.Errorf("CreatePollWithin: %v", err)
+				}
+			}(polls[i])
+		}
+		wg.Wait()
+		if n, _ := s.CountActivePollsByUser(5); created.Load() != max || n != max {
+			t.Fatalf("%d creations succeeded and %d polls exist, want %d", created.Load(), n, max)
+		}
+
+		since := time.Now().Add(-time.Minute)
+		for i := 0; i < attempts; i++ {
+			poll := NewPoll(6, time.Hour, "a", "b")
+			mustCreate(t, s, poll)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.CastVoteWithin(poll.ID, poll.Options[0].ID, 9, since, limit(max))
+				if err == nil {
+					voted.Add(1)
+				} else if !errors.Is(err, errQuota) {
+					t.Errorf("CastVoteWithin: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n, _ := s.CountVotesByUserSince(9, since); voted.Load() != max || n != max {
+			t.Fatalf("%d votes succeeded and %d were recorded, want %d", voted.Load(), n, max)
+		}
+	})
+
+	t.Run("UpdatePollDetails", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(1, time.Hour, "a", "b")
+		mustCreate(t, s, poll)
+
+		edit := *poll
+		edit.Title = "Edited"
+		if err := s.UpdatePollDetails(&edit); err != nil {
+			t.Fatalf("UpdatePollDetails: %v", err)
+		}
+		if edit.Version != 2 {
+			t.Fatalf("version after edit = %d, want 2", edit.Version)
+		}
+		got, _ := s.GetPollByID(poll.ID)
+		if got.Title != "Edited" || got.Version != 2 {
+			t.Fatalf("got title %q version %d", got.Title, got.Version)
+		}
+
+		stale := *poll
+		stale.Title = "Stale"
+		if err := s.UpdatePollDetails(&stale); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Fatalf("stale edit: err = %v, want ErrVersionConflict", err)
+		}
+		missing := *poll
+		missing.ID = 9999
+		if err := s.UpdatePollDetails(&missing); !errors.Is(err, repository.ErrPollNotFound) {
+			t.Fatalf("missing poll: err = %v, want ErrPollNotFound", err)
+		}
+	})
+
+	t.Run("HighTrafficKeepsTotals", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(1, time.Hour, "a", "b")
+		mustCreate(t, s, poll)
+
+		mustVote(t, s, poll.ID, poll.Options[0].ID, 1)
+		if err := s.SetHighTraffic(poll.ID, true); err != nil {
+			t.Fatalf("SetHighTraffic: %v", err)
+		}
+		for user := uint(2); user < 6; user++ {
+			mustVote(t, s, poll.ID, poll.Options[1].ID, user)
+		}
+		assertVotes(t, s, poll.ID, 1, 4)
+
+		if err := s.SetHighTraffic(poll.ID, false); err != nil {
+			t.Fatalf("SetHighTraffic: %v", err)
+		}
+		assertVotes(t, s, poll.ID, 1, 4)
+		assertNoDrift(t, s)
+
+		if err := s.SetHighTraffic(9999, true); !errors.Is(err, repository.ErrPollNotFound) {
+			t.Fatalf("missing poll: err = %v, want ErrPollNotFound", err)
+		}
+	})
+
+	t.Run("ConcurrentHighTrafficVotes", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(1, time.Hour, "a", "b")
+		mustCreate(t, s, poll)
+		if err := s.SetHighTraffic(poll.ID, true); err != nil {
+			t.Fatalf("SetHighTraffic: %v", err)
+		}
+
+		// Votes race each other and counter repairs; no vote may be lost or counted twice
+		const voters = 40
+		var wg sync.WaitGroup
+		errs := make(chan error, voters+2)
+		for i := 0; i < voters; i++ {
+			wg.Add(1)
+			go func(user uint) {
+				defer wg.Done()
+				if _, err := s.CastVote(poll.ID, poll.Options[user%2].ID, user); err != nil {
+					errs <- err
+				}
+			}(uint(100 + i))
+		}
+		for _, option := range poll.Options {
+			wg.Add(1)
+			go func(optionID uint) {
+				defer wg.Done()
+				if _, err := s.RepairOptionCounter(optionID); err != nil {
+					errs <- err
+				}
+			}(option.ID)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertVotes(t, s, poll.ID, voters/2, voters/2)
+		assertNoDrift(t, s)
+		if err := s.SetHighTraffic(poll.ID, false); err != nil {
+			t.Fatalf("SetHighTraffic: %v", err)
+		}
+		assertVotes(t, s, poll.ID, voters/2, voters/2)
+	})
+
+	t.Run("Reconciliation", func(t *testing.T) {
+		s := newStore(t)
+		poll := NewPoll(1, time.Hour, "a", "b")
+		mustCreate(t, s, poll)
+		mustVote(t, s, poll.ID, poll.Options[0].ID, 1)
+		mustVote(t, s, poll.ID, poll.Options[0].ID, 2)
+		assertNoDrift(t, s)
+
+		if n, err := s.CountMismatchedVotes(0); err != nil || n != 0 {
+			t.Fatalf("CountMismatchedVotes = %d, %v; want 0", n, err)
+		}
+		ballots, err := s.RepairOptionCounter(poll.Options[0].ID)
+		if err != nil || ballots != 2 {
+			t.Fatalf("RepairOptionCounter = %d, %v; want 2", ballots, err)
+		}
+		assertVotes(t, s, poll.ID, 2, 0)
+	})
+}
+
+// RunUserStoreTests checks a UserStore. newStore must return an empty store.
+func RunUserStoreTests(t *testing.T, newStore func(t *testing.T) repository.UserStore) {
+	t.Run("CreateAndLookup", func(t *testing.T) {
+		s := newStore(t)
+		user := &models.User{Username: "alice", Email: "alice@example.com", Password: "hash", Role: "user"}
+		if err := s.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if user.ID == 0 || user.Version != 1 || user.Plan != "free" {
+			t.Fatalf("created user = %+v", user)
+		}
+
+		lookups := map[string]func() (*models.User, error){
+			"ID":       func() (*models.User, error) { return s.GetUserByID(user.ID) },
+			"username": func() (*models.User, error) { return s.GetUserByUsername("alice") },
+			"email":    func() (*models.User, error) { return s.GetUserByEmail("alice@example.com") },
+		}
+		for name, lookup := range lookups {
+			got, err := lookup()
+			if err != nil || got.ID != user.ID || got.Plan != "free" {
+				t.Errorf("by %s: %+v, %v", name, got, err)
+			}
+		}
+	})
+
+	t.Run("LookupMissing", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.GetUserByID(404); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("by ID: err = %v", err)
+		}
+		if _, err := s.GetUserByUsername("nobody"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("by username: err = %v", err)
+		}
+		if _, err := s.GetUserByEmail("nobody@example.com"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("by email: err = %v", err)
+		}
+		if _, err := s.GetUserByOIDCIdentity("https://idp", "sub"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("by OIDC identity: err = %v", err)
+		}
+	})
+
+	t.Run("UpdateUser", func(t *testing.T) {
+		s := newStore(t)
+		user := &models.User{Username: "bob", Email: "bob@example.com", Password: "hash", Role: "user"}
+		if err := s.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		stale := *user
+
+		user.OIDCIssuer = "https://idp"
+		user.OIDCSubject = "bob-sub"
+		if err := s.UpdateUser(user); err != nil {
+			t.Fatalf("UpdateUser: %v", err)
+		}
+		if user.Version != 2 {
+			t.Fatalf("version after update = %d, want 2", user.Version)
+		}
+		got, err := s.GetUserByOIDCIdentity("https://idp", "bob-sub")
+		if err != nil || got.ID != user.ID || got.Version != 2 {
+			t.Fatalf("by OIDC identity: %+v, %v", got, err)
+		}
+
+		stale.Role = "admin"
+		if err := s.UpdateUser(&stale); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Fatalf("stale update: err = %v, want ErrVersionConflict", err)
+		}
+		if stale.Version != 1 {
+			t.Fatalf("failed update changed the version to %d", stale.Version)
+		}
+	})
+
+	t.Run("FieldUpdates", func(t *testing.T) {
+		s := newStore(t)
+		user := &models.User{Username: "carol", Email: "carol@example.com", Password: "hash", Role: "user"}
+		if err := s.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+
+		if err := s.UpdateRole(user.ID, "moderator", 1); err != nil {
+			t.Fatalf("UpdateRole: %v", err)
+		}
+		if err := s.UpdatePlan(user.ID, "pro", 2); err != nil {
+			t.Fatalf("UpdatePlan: %v", err)
+		}
+		// Both are based on a version the caller read
+		if err := s.UpdateRole(user.ID, "admin", 2); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Fatalf("stale UpdateRole: err = %v, want ErrVersionConflict", err)
+		}
+		if err := s.UpdatePlan(404, "pro", 1); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Fatalf("UpdatePlan of a missing user: err = %v, want ErrVersionConflict", err)
+		}
+		if err := s.UpdateRefreshToken(user.ID, "refresh"); err != nil {
+			t.Fatalf("UpdateRefreshToken: %v", err)
+		}
+
+		got, _ := s.GetUserByID(user.ID)
+		if got.Role != "moderator" || got.Plan != "pro" || got.RefreshToken != "refresh" {
+			t.Fatalf("got %+v", got)
+		}
+		// Role and plan changes are edits; refreshing a session is not
+		if got.Version != 3 {
+			t.Fatalf("version = %d, want 3", got.Version)
+		}
+	})
+
+	t.Run("UniqueOIDCIdentity", func(t *testing.T) {
+		s := newStore(t)
+		// Local accounts have no identity and never conflict
+		for _, name := range []string{"dave", "erin"} {
+			if err := s.CreateUser(&models.User{Username: name, Email: name + "@example.com", Password: "hash", Role: "user"}); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+		}
+		linked := &models.User{Username: "frank", Email: "frank@example.com", Role: "user", OIDCIssuer: "https://idp", OIDCSubject: "sub"}
+		if err := s.CreateUser(linked); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+
+		twin := &models.User{Username: "frank2", Email: "frank2@example.com", Role: "user", OIDCIssuer: "https://idp", OIDCSubject: "sub"}
+		if err := s.CreateUser(twin); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Fatalf("second account for the identity: err = %v", err)
+		}
+		dave, _ := s.GetUserByUsername("dave")
+		dave.OIDCIssuer, dave.OIDCSubject = "https://idp", "sub"
+		if err := s.UpdateUser(dave); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Fatalf("linking a taken identity: err = %v", err)
+		}
+	})
+}
+
+func mustCreate(t *testing.T, s repository.PollStore, poll *models.Poll) {
+	t.Helper()
+	if err := s.CreatePoll(poll); err != nil {
+		t.Fatalf("CreatePoll: %v", err)
+	}
+}
+
+func mustVote(t *testing.T, s repository.PollStore, pollID, optionID, userID uint) {
+	t.Helper()
+	if _, err := s.CastVote(pollID, optionID, userID); err != nil {
+		t.Fatalf("CastVote(%d, %d, %d): %v", pollID, optionID, userID, err)
+	}
+}
+
+func assertVotes(t *testing.T, s repository.PollStore, pollID uint, want ...int) {
+	t.Helper()
+	poll, err := s.GetPollByID(pollID)
+	if err != nil {
+		t.Fatalf("GetPollByID: %v", err)
+	}
+	got := make([]int, len(poll.Options))
+	for i, o := range poll.Options {
+		got[i] = o.Votes
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("votes = %v, want %v", got, want)
+	}
+}
+
+func assertNoDrift(t *testing.T, s repository.PollStore) {
+	t.Helper()
+	drift, err := s.FindCounterDrift(0)
+	if err != nil {
+		t.Fatalf("FindCounterDrift: %v", err)
+	}
+	if len(drift) != 0 {
+		t.Fatalf("drift = %+v", drift)
+	}
+}
+
+func pollIDs(polls []models.Poll) []uint {
+	ids := make([]uint, len(polls))
+	for i, p := range polls {
+		ids[i] = p.ID
+	}
+	return ids
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"pollingPlatform/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TokenRepository struct {
+	db *gorm.DB
+}
+
+func NewTokenRepository(db *gorm.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+func (r *TokenRepository) CreateToken(token *models.PersonalAccessToken) error {
+	return r.db.Create(token).Error
+}
+
+// GetTokenByHash returns the token with its owner loaded
+func (r *TokenRepository) GetTokenByHash(hash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := r.db.Preload("User").Where("token_hash = ?", hash).First(&token).Error
+	return &token, err
+}
+
+func (r *TokenRepository) ListTokensByUser(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *TokenRepository) CountActiveTokens(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// RevokeToken revokes one of the user's tokens; it reports false if no such token exists
+func (r *TokenRepository) RevokeToken(id, userID uint) (bool, error) {
+	result := r.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *TokenRepository) TouchToken(id uint, ip string, usedAt time.Time) error {
+	return r.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"last_used_at": usedAt, "last_used_ip": ip}).Error
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"pollingPlatform/models"
 
 	"gorm.io/gorm"
@@ -20,7 +21,12 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+func (r *UserRepository) WithContext(ctx context.Context) UserStore {
+	return &UserRepository{db: r.db.WithContext(ctx)}
+}
+
 func (r *UserRepository) CreateUser(user *models.User) error {
+	user.Version = 1
 	return r.db.Create(user).Error
 }
 
@@ -36,8 +42,53 @@ func (r *UserRepository) GetUserByID(id uint) (*models.User, error) {
 	return &user, err
 }
 
+func (r *UserRepository) GetUserByOIDCIdentity(issuer, subject string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, subject).First(&user).Error
+	return &user, err
+}
+
+// UpdateUser saves every field of user. It returns ErrVersionConflict if the user was
+// changed since user.Version was read; on success the version is bumped.
 func (r *UserRepository) UpdateUser(user *models.User) error {
-	return r.db.Save(user).Error
+	expected := user.Version
+	user.Version++
+	result := r.db.Model(user).
+		Where("version = ?", expected).
+		Select("*").
+		Omit("created_at").
+		Updates(user)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrVersionConflict
+	}
+	if result.Error != nil {
+		user.Version = expected
+	}
+	return result.Error
+}
+
+// UpdateRole sets the user's role and bumps their version, provided they are still at
+// version. It returns ErrVersionConflict if the user changed since or doesn't exist.
+func (r *UserRepository) UpdateRole(userID uint, role string, version uint) error {
+	return r.updateAtVersion(userID, version, "role", role)
+}
+
+// UpdatePlan is UpdateRole for the user's plan
+func (r *UserRepository) UpdatePlan(userID uint, plan string, version uint) error {
+	return r.updateAtVersion(userID, version, "plan", plan)
+}
+
+func (r *UserRepository) updateAtVersion(userID, version uint, column string, value interface{}) error {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND version = ?", userID, version).
+		Updates(map[string]interface{}{
+			column:    value,
+			"version": gorm.Expr("version + 1"),
+		})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	return result.Error
 }
 
 func (r *UserRepository) UpdateRefreshToken(userID uint, token string) error {
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+	"pollingPlatform/config"
+)
+
+// NewHTTPServer wraps handler in a server with the configured timeouts and header limit
+func NewHTTPServer(cfg config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
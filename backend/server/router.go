@@ -0,0 +1,199 @@
+// Package server assembles the HTTP API.
+package server
+
+import (
+	"pollingPlatform/handlers"
+	"pollingPlatform/health"
+	"pollingPlatform/keys"
+	"pollingPlatform/metrics"
+	"pollingPlatform/middleware"
+	"pollingPlatform/models"
+	"pollingPlatform/quota"
+	"pollingPlatform/rbac"
+	"pollingPlatform/reconcile"
+	"pollingPlatform/repository"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Deps are the stores and services the API is built from. Background workers
+// (key rotation, cleanup jobs) are started and stopped by the caller.
+type Deps struct {
+	Polls  repository.PollStore
+	Users  repository.UserStore
+	Tokens *repository.TokenRepository
+	Roles  *repository.RoleRepository
+	Plans  *repository.PlanRepository
+
+	Authz       *rbac.Authorizer
+	Quotas      *quota.Service
+	Keys        *keys.Manager
+	JWT         *middleware.JWTService
+	LoginGuard  *middleware.LoginGuard
+	RateLimiter *middleware.RateLimiter
+	// RateLimits must contain every policy named in DefaultRateLimits
+	RateLimits  map[string]middleware.Policy
+	Idempotency *middleware.Idempotency
+	Reconciler  *reconcile.Reconciler
+
+	// OIDC is optional; the single sign-on routes are only registered when it is set
+	OIDC *handlers.OIDCHandler
+
+	// CORSOrigins may call the API from a browser; CORS is off when it is empty
+	CORSOrigins []string
+	// MaxBodyBytes caps request bodies; 0 means no limit
+	MaxBodyBytes int64
+	// Metrics is served at /metrics in the Prometheus text format when set
+	Metrics *metrics.Registry
+	// Health backs /readyz; /healthz is always served
+	Health *health.Checker
+}
+
+var registerValidators sync.Once
+
+// NewRouter builds the Gin engine with every route and middleware
+func NewRouter(d Deps) *gin.Engine {
+	authz := d.Authz
+	rateLimiter := d.RateLimiter
+	limits := d.RateLimits
+	idempotency := d.Idempotency
+
+	// Initialize handlers
+	authHandler := handlers.NewAuthHandler(d.Users, d.LoginGuard, d.JWT)
+	pollHandler := handlers.NewPollHandler(d.Polls, d.Quotas, authz)
+	tokenHandler := handlers.NewTokenHandler(d.Tokens)
+	quotaHandler := handlers.NewQuotaHandler(d.Quotas, d.Plans, d.Users)
+	adminHandler := handlers.NewAdminHandler(d.LoginGuard, authz, d.Roles, d.Users)
+	jwksHandler := handlers.NewJWKSHandler(d.Keys)
+	reconcileHandler := handlers.NewReconcileHandler(d.Reconciler)
+	healthHandler := handlers.NewHealthHandler(d.Health)
+	oidcHandler := d.OIDC
+
+	// Initialize Gin; requests are traced and logged through slog with their request ID
+	r := gin.New()
+	r.Use(middleware.Tracing(), middleware.RequestID(), middleware.RequestLogger(), middleware.Metrics(), middleware.Recovery())
+
+	// Configure CORS
+	if len(d.CORSOrigins) > 0 {
+		r.Use(cors.New(cors.Config{
+			AllowOrigins:     d.CORSOrigins,
+			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-Request-ID", "Idempotency-Key", "If-None-Match", "If-Modified-Since", "If-Match"},
+			ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Idempotent-Replayed", "ETag", "Last-Modified"},
+			AllowCredentials: true,
+			MaxAge:           12 * time.Hour,
+		}))
+	}
+
+	// Reject oversized request bodies before anything reads them
+	if d.MaxBodyBytes > 0 {
+		r.Use(middleware.BodyLimit(d.MaxBodyBytes))
+	}
+
+	// Add custom validator for future dates
+	registerValidators.Do(func() {
+		if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+			v.RegisterValidation("future", func(fl validator.FieldLevel) bool {
+				date, ok := fl.Field().Interface().(time.Time)
+				if !ok {
+					return false
+				}
+				return date.After(time.Now())
+			})
+		}
+	})
+
+	// Orchestrator probes
+	r.GET("/healthz", healthHandler.Live)
+	if d.Health != nil {
+		r.GET("/readyz", healthHandler.Ready)
+	}
+
+	// Prometheus scrape endpoint
+	if d.Metrics != nil {
+		r.GET("/metrics", gin.WrapH(d.Metrics.Handler()))
+	}
+
+	// Public keys for verifying our tokens
+	r.GET("/.well-known/jwks.json", jwksHandler.GetJWKS)
+
+	// Routes
+	api := r.Group("/api")
+	{
+		// Auth routes (limited per client IP)
+		api.POST("/register", rateLimiter.Middleware(limits["register"]), authHandler.Register)
+		api.POST("/login", rateLimiter.Middleware(limits["login"]), authHandler.Login)
+		api.POST("/refresh-token", rateLimiter.Middleware(limits["refresh"]), authHandler.RefreshToken)
+
+		// Single sign-on routes (only when an identity provider is configured; they share
+		// the password login's limit)
+		if oidcHandler != nil {
+			api.GET("/auth/oidc/login", rateLimiter.Middleware(limits["login"]), oidcHandler.Login)
+			api.GET("/auth/oidc/callback", rateLimiter.Middleware(limits["login"]), oidcHandler.Callback)
+		}
+
+		// Public poll routes (no authentication required)
+		api.GET("/polls", rateLimiter.Middleware(limits["poll-list"]), pollHandler.ListPolls)
+		api.GET("/polls/:id", rateLimiter.Middleware(limits["poll-read"]), pollHandler.GetPoll)
+
+		// Protected routes
+		authenticated := api.Group("/")
+		authenticated.Use(middleware.AuthMiddleware(d.JWT, d.Tokens))
+		{
+			authenticated.GET("/me", authHandler.GetMe)
+			authenticated.GET("/me/usage", middleware.RequireScope(models.ScopePollsRead), quotaHandler.GetUsage)
+
+			// Personal access tokens can only be managed from an interactive session
+			tokens := authenticated.Group("/tokens", middleware.RequireSession())
+			tokens.GET("", tokenHandler.ListTokens)
+			tokens.POST("", tokenHandler.CreateToken)
+			tokens.DELETE("/:id", tokenHandler.RevokeToken)
+
+			// Protected poll routes (authentication required)
+			authenticated.POST("/polls", middleware.RequireScope(models.ScopePollsWrite), middleware.RequirePermission(authz, rbac.PermPollsCreate), idempotency.Middleware(), rateLimiter.Middleware(limits["poll-create"]), pollHandler.CreatePoll)
+			authenticated.PUT("/polls/:id", middleware.RequireScope(models.ScopePollsWrite), pollHandler.UpdatePoll)
+			authenticated.POST("/polls/:id/vote", middleware.RequireScope(models.ScopeVotesWrite), middleware.RequirePermission(authz, rbac.PermPollsVote), idempotency.Middleware(), rateLimiter.Middleware(limits["vote"]), pollHandler.Vote)
+
+			// Admin routes
+			admin := authenticated.Group("/admin", middleware.RequireSession())
+			admin.GET("/lockouts", middleware.RequirePermission(authz, rbac.PermSecurityManage), adminHandler.ListLockouts)
+			admin.DELETE("/lockouts/:kind/:subject", middleware.RequirePermission(authz, rbac.PermSecurityManage), adminHandler.ClearLockout)
+			admin.GET("/permissions", middleware.RequirePermission(authz, rbac.PermRolesManage), adminHandler.ListPermissions)
+			admin.GET("/roles", middleware.RequirePermission(authz, rbac.PermRolesManage), adminHandler.ListRoles)
+			admin.POST("/roles", middleware.RequirePermission(authz, rbac.PermRolesManage), adminHandler.CreateRole)
+			admin.PUT("/roles/:name/permissions", middleware.RequirePermission(authz, rbac.PermRolesManage), adminHandler.SetRolePermissions)
+			admin.PUT("/users/:id/role", middleware.RequirePermission(authz, rbac.PermUsersManage), adminHandler.AssignRole)
+			admin.GET("/plans", middleware.RequirePermission(authz, rbac.PermPlansManage), quotaHandler.ListPlans)
+			admin.POST("/plans", middleware.RequirePermission(authz, rbac.PermPlansManage), quotaHandler.CreatePlan)
+			admin.PUT("/plans/:name", middleware.RequirePermission(authz, rbac.PermPlansManage), quotaHandler.UpdatePlan)
+			admin.PUT("/users/:id/plan", middleware.RequirePermission(authz, rbac.PermPlansManage), quotaHandler.AssignPlan)
+			admin.PUT("/polls/:id/high-traffic", middleware.RequirePermission(authz, rbac.PermPollsManage), pollHandler.SetHighTraffic)
+			admin.GET("/reconciliation", middleware.RequirePermission(authz, rbac.PermPollsManage), reconcileHandler.GetReport)
+			admin.POST("/reconciliation", middleware.RequirePermission(authz, rbac.PermPollsManage), reconcileHandler.Run)
+		}
+	}
+
+	return r
+}
+
+// DefaultRateLimits returns the per-route rate limits
+func DefaultRateLimits() map[string]middleware.Policy {
+	policies := map[string]middleware.Policy{}
+	for _, p := range []middleware.Policy{
+		{Name: "register", Limit: 5, Period: time.Hour, Key: middleware.KeyByIP},       // 5 registrations per hour
+		{Name: "login", Limit: 20, Period: time.Minute, Key: middleware.KeyByIP},       // 20 login attempts per minute
+		{Name: "refresh", Limit: 30, Period: time.Minute, Key: middleware.KeyByIP},     // 30 refreshes per minute
+		{Name: "poll-list", Limit: 120, Period: time.Minute, Key: middleware.KeyByIP},  // 120 listings per minute
+		{Name: "poll-read", Limit: 300, Period: time.Minute, Key: middleware.KeyByIP},  // 300 poll reads per minute
+		{Name: "poll-create", Limit: 10, Period: time.Hour, Key: middleware.KeyByUser}, // 10 polls per hour
+		{Name: "vote", Limit: 100, Period: time.Minute, Key: middleware.KeyByAPIKey},   // 100 votes per minute
+	} {
+		policies[p.Name] = p
+	}
+	return policies
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"pollingPlatform/config"
+	"pollingPlatform/handlers"
+	"pollingPlatform/health"
+	"pollingPlatform/keys"
+	"pollingPlatform/metrics"
+	"pollingPlatform/middleware"
+	"pollingPlatform/migrations"
+	"pollingPlatform/oidc"
+	"pollingPlatform/quota"
+	"pollingPlatform/rbac"
+	"pollingPlatform/reconcile"
+	"pollingPlatform/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// keyReloadInterval is how often each instance reloads the signing keys and rotates
+// them when due
+const keyReloadInterval = time.Hour
+
+// Options adjust NewServices beyond what the configuration covers
+type Options struct {
+	// Polls and Users replace the GORM stores when set, e.g. with in-memory stores
+	Polls repository.PollStore
+	Users repository.UserStore
+	// Stats receives the connection pool and poll cache statistics. They are read
+	// from this instance's database and cache, so a registry can take them only once.
+	Stats *metrics.Registry
+}
+
+// Services are the API dependencies built from the configuration, plus the
+// background workers behind them
+type Services struct {
+	Deps
+
+	rateLimitStore middleware.RateLimitStore
+	webhooks       *middleware.WebhookNotifier
+	workers        []worker
+}
+
+// worker is a background job that Start and Stop run in order
+type worker struct {
+	start func()
+	stop  func()
+}
+
+// NewServices builds every store and service of the API on db and registers the
+// readiness checks. The database must already be migrated; workers run once Start
+// is called.
+func NewServices(cfg *config.Config, db *gorm.DB, opts Options) (*Services, error) {
+	s := &Services{}
+	d := &s.Deps
+
+	// Stores
+	pollRepo := repository.NewPollRepository(db)
+	if cfg.PollCache.Size > 0 {
+		pollRepo.EnableCache(cfg.PollCache.Size)
+		if opts.Stats != nil {
+			metrics.RegisterCacheStats(opts.Stats, "poll", pollRepo.PollCacheStats)
+			metrics.RegisterCacheStats(opts.Stats, "poll_list", pollRepo.ListCacheStats)
+		}
+	}
+	d.Polls, d.Users = pollRepo, repository.NewUserRepository(db)
+	if opts.Polls != nil {
+		d.Polls = opts.Polls
+	}
+	if opts.Users != nil {
+		d.Users = opts.Users
+	}
+	d.Tokens = repository.NewTokenRepository(db)
+	d.Roles = repository.NewRoleRepository(db)
+	d.Plans = repository.NewPlanRepository(db)
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Stats != nil {
+		metrics.RegisterDBStats(opts.Stats, sqlDB)
+	}
+
+	// Roles and permissions
+	d.Authz = rbac.NewAuthorizer(d.Roles)
+	if err := d.Authz.Seed(); err != nil {
+		return nil, fmt.Errorf("seeding roles: %w", err)
+	}
+	s.addWorker(func() { d.Authz.Start(time.Minute) }, d.Authz.Stop)
+
+	// Plans and quotas
+	d.Quotas = quota.NewService(d.Plans, d.Users, d.Polls)
+	if err := d.Quotas.Seed(); err != nil {
+		return nil, fmt.Errorf("seeding plans: %w", err)
+	}
+
+	// JWT signing keys; a new key waits two reloads before it signs, so a late tick on
+	// another instance doesn't leave it rejecting the new kid
+	d.Keys, err = keys.NewManager(repository.NewSigningKeyRepository(db), keys.Config{
+		Algorithm:        cfg.JWT.SigningAlg,
+		Secret:           cfg.JWT.Secret,
+		RotationInterval: cfg.JWT.KeyRotation,
+		PublishDelay:     2 * keyReloadInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("initializing signing keys: %w", err)
+	}
+	s.addWorker(func() { d.Keys.Start(keyReloadInterval) }, d.Keys.Stop)
+	legacySecret := ""
+	if cfg.JWT.AcceptLegacyHS256 {
+		legacySecret = cfg.JWT.Secret
+	}
+	d.JWT = middleware.NewJWTService(d.Keys, cfg.JWT.Issuer, legacySecret)
+
+	// Brute-force protection for logins
+	var loginNotifier middleware.LoginNotifier = middleware.LogNotifier{}
+	if cfg.LoginAlerts.WebhookURL != "" {
+		s.webhooks = middleware.NewWebhookNotifier(cfg.LoginAlerts.WebhookURL)
+		loginNotifier = s.webhooks
+	}
+	d.LoginGuard = middleware.NewLoginGuard(middleware.DefaultLoginGuardConfig(), loginNotifier)
+	s.addWorker(func() { d.LoginGuard.Start(5 * time.Minute) }, d.LoginGuard.Stop)
+
+	// Rate limiting per user, IP or API key: "memory" keeps state per instance,
+	// "postgres" shares it between instances
+	if cfg.RateLimit.Store == "postgres" {
+		s.rateLimitStore = middleware.NewPostgresRateLimitStore(repository.NewRateLimitRepository(db))
+	} else {
+		s.rateLimitStore = middleware.NewMemoryRateLimitStore()
+	}
+	s.addWorker(func() { s.rateLimitStore.Start(time.Minute) }, s.rateLimitStore.Stop)
+	d.RateLimiter = middleware.NewRateLimiter(s.rateLimitStore)
+	d.RateLimits = DefaultRateLimits()
+	if err := middleware.ParsePolicyOverrides(d.RateLimits, cfg.RateLimit.Policies); err != nil {
+		return nil, fmt.Errorf("rate limit policies: %w", err)
+	}
+
+	// Replay responses for retried requests carrying an Idempotency-Key
+	d.Idempotency = middleware.NewIdempotency(repository.NewIdempotencyRepository(db), 24*time.Hour)
+	s.addWorker(func() { d.Idempotency.Start(time.Hour) }, d.Idempotency.Stop)
+
+	// Check denormalized vote counters against ballots
+	d.Reconciler = reconcile.NewReconciler(d.Polls)
+	if cfg.Reconcile.Interval > 0 {
+		s.addWorker(func() { d.Reconciler.Start(cfg.Reconcile.Interval, cfg.Reconcile.Repair) }, d.Reconciler.Stop)
+	}
+
+	// Single sign-on
+	if cfg.OIDC.IssuerURL != "" {
+		if d.OIDC, err = newOIDCHandler(cfg.OIDC, d.Users, d.JWT, d.Authz); err != nil {
+			return nil, err
+		}
+	}
+
+	// Readiness: the database answers, the schema is current and workers keep running
+	migrator, err := migrations.New(sqlDB, cfg.Database.Driver)
+	if err != nil {
+		return nil, err
+	}
+	d.Health = health.NewChecker(2 * time.Second)
+	d.Health.Add("database", sqlDB.PingContext)
+	d.Health.Add("migrations", func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err == nil && pending > 0 {
+			err = fmt.Errorf("%d migrations pending", pending)
+		}
+		return err
+	})
+	d.Health.AddWorker("role_reload", time.Minute)
+	d.Health.AddWorker("signing_keys", keyReloadInterval)
+	d.Health.AddWorker("idempotency_cleanup", time.Hour)
+	if cfg.RateLimit.Store == "postgres" {
+		d.Health.AddWorker("rate_limit_cleanup", time.Minute)
+	}
+	if cfg.Reconcile.Interval > 0 {
+		d.Health.AddWorker("reconcile", cfg.Reconcile.Interval)
+	}
+
+	d.CORSOrigins = cfg.Server.CORSOrigins
+	d.MaxBodyBytes = int64(cfg.Server.MaxBodyBytes)
+	if cfg.Metrics.Enabled {
+		d.Metrics = metrics.Default
+	}
+	return s, nil
+}
+
+func (s *Services) addWorker(start, stop func()) {
+	s.workers = append(s.workers, worker{start: start, stop: stop})
+}
+
+// Start runs the background workers: role reloads, key rotation, cleanup jobs and
+// reconciliation
+func (s *Services) Start() {
+	for _, w := range s.workers {
+		w.start()
+	}
+}
+
+// Stop stops the workers, newest first, and delivers queued login alerts
+func (s *Services) Stop() {
+	for i := len(s.workers) - 1; i >= 0; i-- {
+		s.workers[i].stop()
+	}
+	if s.webhooks != nil {
+		s.webhooks.Close()
+	}
+}
+
+// newOIDCHandler builds the single sign-on handler for the configured issuer
+func newOIDCHandler(cfg config.OIDC, users repository.UserStore, jwtService *middleware.JWTService, authz *rbac.Authorizer) (*handlers.OIDCHandler, error) {
+	mappings, err := oidc.ParseRoleMappings(cfg.RoleMapping)
+	if err != nil {
+		return nil, fmt.Errorf("oidc role mapping: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		IssuerURL:    cfg.IssuerURL,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+		GroupsClaim:  cfg.GroupsClaim,
+		RoleMappings: mappings,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("initializing OIDC provider: %w", err)
+	}
+
+	return handlers.NewOIDCHandler(
+		provider,
+		users,
+		oidc.NewStateStore(10*time.Minute),
+		jwtService,
+		authz,
+		len(mappings) > 0,
+		cfg.FrontendRedirectURL,
+	), nil
+}
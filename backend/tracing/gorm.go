@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// querySpanKey stores the span of a statement between the before and after callbacks
+const querySpanKey = "tracing:span"
+
+type querySpan struct {
+	span   trace.Span
+	parent context.Context
+}
+
+// GormPlugin records a client span for each query whose context already carries a
+// span, so queries nest under the request or job that ran them. Queries run without
+// a context, such as migrations, are not traced. The SQL is recorded with its
+// placeholders, never the values.
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string { return "tracing" }
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("*").Register("tracing:before_create", startQuerySpan),
+		cb.Create().After("*").Register("tracing:after_create", endQuerySpan),
+		cb.Query().Before("*").Register("tracing:before_query", startQuerySpan),
+		cb.Query().After("*").Register("tracing:after_query", endQuerySpan),
+		cb.Update().Before("*").Register("tracing:before_update", startQuerySpan),
+		cb.Update().After("*").Register("tracing:after_update", endQuerySpan),
+		cb.Delete().Before("*").Register("tracing:before_delete", startQuerySpan),
+		cb.Delete().After("*").Register("tracing:after_delete", endQuerySpan),
+		cb.Row().Before("*").Register("tracing:before_row", startQuerySpan),
+		cb.Row().After("*").Register("tracing:after_row", endQuerySpan),
+		cb.Raw().Before("*").Register("tracing:before_raw", startQuerySpan),
+		cb.Raw().After("*").Register("tracing:after_raw", endQuerySpan),
+	)
+}
+
+func startQuerySpan(db *gorm.DB) {
+	parent := db.Statement.Context
+	if parent == nil || !trace.SpanContextFromContext(parent).IsValid() {
+		return
+	}
+	ctx, span := tracer.Start(parent, "db", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemNameKey.String(dbSystem(db.Dialector.Name()))))
+	db.Statement.Context = ctx
+	db.InstanceSet(querySpanKey, querySpan{span: span, parent: parent})
+}
+
+func endQuerySpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(querySpanKey)
+	if !ok {
+		return
+	}
+	qs := value.(querySpan)
+	db.Statement.Context = qs.parent
+
+	sql := db.Statement.SQL.String()
+	operation, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+	operation = strings.ToUpper(operation)
+	name := operation
+	if table := db.Statement.Table; table != "" {
+		qs.span.SetAttributes(semconv.DBCollectionName(table))
+		name = strings.TrimSpace(operation + " " + table)
+	}
+	if name != "" {
+		qs.span.SetName(name)
+	}
+	qs.span.SetAttributes(
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(sql),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		qs.span.RecordError(err)
+		qs.span.SetStatus(codes.Error, err.Error())
+	}
+	qs.span.End()
+}
+
+// dbSystem maps GORM dialect names to the OpenTelemetry db.system.name values
+func dbSystem(dialect string) string {
+	if dialect == "postgres" {
+		return "postgresql"
+	}
+	return dialect
+}
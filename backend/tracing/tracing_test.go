@@ -0,0 +1,146 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pollingPlatform/middleware"
+	"pollingPlatform/models"
+	"pollingPlatform/repository/storetest"
+	"pollingPlatform/tracing"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The global provider can only be installed once, so the tests share a recorder and
+// look at the spans each of them ends
+var recorder = tracetest.NewSpanRecorder()
+
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	gin.SetMode(gin.TestMode)
+	m.Run()
+}
+
+func endedSince(n int) []sdktrace.ReadOnlySpan {
+	return recorder.Ended()[n:]
+}
+
+func TestQuerySpans(t *testing.T) {
+	db := storetest.OpenSQLite(t)
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	before := len(recorder.Ended())
+
+	// Without a span in the context nothing is recorded
+	var count int64
+	if err := db.Model(&models.Poll{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if spans := endedSince(before); len(spans) != 0 {
+		t.Fatalf("untraced query recorded %d spans", len(spans))
+	}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	var poll models.Poll
+	err := db.WithContext(ctx).First(&poll, 42).Error
+	parent.End()
+	if err == nil {
+		t.Fatal("expected record not found")
+	}
+
+	spans := endedSince(before)
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the query and its parent", len(spans))
+	}
+	query := spans[0]
+	if query.Name() != "SELECT polls" {
+		t.Errorf("span name %q", query.Name())
+	}
+	if query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("query span is not a child of the request")
+	}
+	if query.Status().Code == codes.Error {
+		t.Error("record not found marked as an error")
+	}
+	attrs := map[string]string{}
+	for _, kv := range query.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["db.system.name"] != "sqlite" || attrs["db.collection.name"] != "polls" {
+		t.Errorf("attributes %v", attrs)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	before := len(recorder.Ended())
+	failure := errors.New("boom")
+
+	err := tracing.RunJob("cleanup", func(ctx context.Context) error {
+		if !hasSpan(ctx) {
+			t.Error("job context carries no span")
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("RunJob returned %v", err)
+	}
+
+	spans := endedSince(before)
+	if len(spans) != 1 || spans[0].Name() != "job cleanup" {
+		t.Fatalf("spans %v", spans)
+	}
+	if spans[0].Parent().IsValid() {
+		t.Error("job span should start a new trace")
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Error("failed job not marked as an error")
+	}
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	before := len(recorder.Ended())
+
+	r := gin.New()
+	r.Use(middleware.Tracing())
+	r.GET("/api/polls/:id", func(c *gin.Context) {
+		if !hasSpan(c.Request.Context()) {
+			t.Error("handler context carries no span")
+		}
+		c.Status(http.StatusInternalServerError)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/polls/7", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := endedSince(before)
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /api/polls/:id" {
+		t.Errorf("span name %q", span.Name())
+	}
+	if span.SpanContext().TraceID().String() != traceID || !span.Parent().IsRemote() {
+		t.Error("incoming trace context not continued")
+	}
+	if span.Status().Code != codes.Error {
+		t.Error("5xx not marked as an error")
+	}
+}
+
+func hasSpan(ctx context.Context) bool {
+	return trace.SpanContextFromContext(ctx).IsValid()
+}